@@ -2,44 +2,364 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
-func createHeader(path string) ([]byte, error) {
-	header := make([]byte, 512)
+// packer streams the archive entries of all files passed to create to w.
+type packer struct {
+	w io.Writer
+
+	// links maps every hard linked file to the name it was first archived as
+	links map[inode]string
+
+	users  map[uint32]string
+	groups map[uint32]string
+
+	// log receives the name of every archived member if not nil
+	log io.Writer
+
+	// self is the archive file itself, which is never archived
+	self *inode
+
+	// archived holds the mtime of every member already in the archive when
+	// updating it, files that are not newer are skipped
+	archived map[string]time.Time
+
+	// excludes keeps matching files and directories out of the archive
+	excludes patterns
+
+	strippedSlash bool
+}
+
+type inode struct {
+	dev, ino uint64
+}
+
+func newPacker(w io.Writer) *packer {
+	return &packer{
+		w:      w,
+		links:  map[inode]string{},
+		users:  map[uint32]string{},
+		groups: map[uint32]string{},
+	}
+}
 
-	stat, err := os.Stat(path)
+// exclude keeps the file stat out of the archive.
+func (p *packer) exclude(stat fs.FileInfo) {
+	if sys, ok := stat.Sys().(*syscall.Stat_t); ok {
+		p.self = &inode{dev: uint64(sys.Dev), ino: uint64(sys.Ino)}
+	}
+}
+
+// finish writes the two zero blocks that end the archive.
+func (p *packer) finish() error {
+	_, err := p.w.Write(make([]byte, 1024))
+	return err
+}
+
+// pack archives path and, if it is a directory, everything below it.
+// Symbolic links are archived as links and never followed.
+func (p *packer) pack(root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p.excludes.excludes(p.archiveName(path)) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return p.packEntry(path)
+	})
+}
+
+func (p *packer) packEntry(path string) error {
+
+	stat, err := os.Lstat(path)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	if sys, ok := stat.Sys().(*syscall.Stat_t); ok && p.self != nil {
+		if *p.self == (inode{dev: uint64(sys.Dev), ino: uint64(sys.Ino)}) {
+			fmt.Fprintf(os.Stderr, "[WARNING] %s: file is the archive, skipping\n", path)
+			return nil
+		}
+	}
+
+	info, err := p.statInfo(path, stat)
+	if err != nil {
+		return err
+	}
+
+	if info == nil {
+		fmt.Fprintf(os.Stderr, "[WARNING] %s: file type not supported, skipping\n", path)
+		return nil
+	}
+
+	if mtime, ok := p.archived[info.fileName]; ok && info.lastModDate.Unix() <= mtime.Unix() {
+		return nil
+	}
+
+	if p.log != nil {
+		fmt.Fprintln(p.log, info.fileName)
+	}
+
+	if _, err := p.w.Write(createHeaders(info)); err != nil {
+		return err
+	}
+
+	if info.typeFlag != typeRegular {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := io.Copy(p.w, io.LimitReader(f, int64(info.fileSize)))
+	if err != nil {
+		return err
+	}
+
+	if uint64(n) != info.fileSize {
+		return fmt.Errorf("%s: file shrank while reading it", path)
+	}
+
+	_, err = p.w.Write(make([]byte, 512*ceil512(info.fileSize)-info.fileSize))
+	return err
+}
+
+// statInfo describes the file at path in the archive, or returns nil if its
+// type cannot be archived.
+func (p *packer) statInfo(path string, stat fs.FileInfo) (*fileInfo, error) {
+
+	info := &fileInfo{
+		fileName:    p.archiveName(path),
+		fileMode:    tarMode(stat.Mode()),
+		lastModDate: stat.ModTime(),
+	}
+
+	if sys, ok := stat.Sys().(*syscall.Stat_t); ok {
+		info.ownerUserID = uint64(sys.Uid)
+		info.ownerGroupID = uint64(sys.Gid)
+		info.ownerUserName = p.userName(sys.Uid)
+		info.ownerGroupName = p.groupName(sys.Gid)
+
+		if stat.Mode().IsRegular() && sys.Nlink > 1 {
+			id := inode{dev: uint64(sys.Dev), ino: uint64(sys.Ino)}
+			if first, ok := p.links[id]; ok {
+				info.typeFlag = typeHardLink
+				info.linkName = first
+				return info, nil
+			}
+			p.links[id] = info.fileName
+		}
+	}
+
+	switch mode := stat.Mode(); {
+	case mode.IsRegular():
+		info.typeFlag = typeRegular
+		info.fileSize = uint64(stat.Size())
+	case mode.IsDir():
+		info.typeFlag = typeDirectory
+		if !strings.HasSuffix(info.fileName, "/") {
+			info.fileName += "/"
+		}
+	case mode&fs.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil, err
+		}
+		info.typeFlag = typeSymlink
+		info.linkName = target
+	default:
+		return nil, nil
 	}
 
-	copyText(header, 0, 100, stat.Name())
+	return info, nil
+}
+
+// archiveName turns path into a relative, slash separated member name.
+func (p *packer) archiveName(path string) string {
+
+	name := filepath.ToSlash(filepath.Clean(path))
+
+	if strings.HasPrefix(name, "/") {
+		if !p.strippedSlash {
+			fmt.Fprintln(os.Stderr, "[INFO] removing leading '/' from member names")
+			p.strippedSlash = true
+		}
+		name = strings.TrimLeft(name, "/")
+	}
+
+	if name == "" {
+		name = "."
+	}
+
+	return name
+}
+
+func (p *packer) userName(uid uint32) string {
+	if name, ok := p.users[uid]; ok {
+		return name
+	}
+	name := ""
+	if u, err := user.LookupId(strconv.FormatUint(uint64(uid), 10)); err == nil {
+		name = u.Username
+	}
+	p.users[uid] = name
+	return name
+}
+
+func (p *packer) groupName(gid uint32) string {
+	if name, ok := p.groups[gid]; ok {
+		return name
+	}
+	name := ""
+	if g, err := user.LookupGroupId(strconv.FormatUint(uint64(gid), 10)); err == nil {
+		name = g.Name
+	}
+	p.groups[gid] = name
+	return name
+}
 
-	copyOctal(header, 100, 8, uint64(stat.Mode()))
+// tarMode converts the permission and special bits to their Unix values.
+func tarMode(mode fs.FileMode) uint64 {
+	m := uint64(mode.Perm())
+	if mode&fs.ModeSetuid != 0 {
+		m |= 04000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		m |= 02000
+	}
+	if mode&fs.ModeSticky != 0 {
+		m |= 01000
+	}
+	return m
+}
 
-	// if linuxstat, ok := stat.Sys().(*syscall.Stat_t); ok {
-	// 	copyOctal(header, 108, 8, uint64(linuxstat.Uid))
-	// 	copyOctal(header, 116, 8, uint64(linuxstat.Gid))
-	// }
+// createHeaders returns the ustar header of info, preceded by a PAX extended
+// header if some field does not fit into the ustar header.
+func createHeaders(info *fileInfo) []byte {
 
-	copyOctal(header, 124, 12, uint64(stat.Size()))
+	records := paxRecords(info)
+	if len(records) == 0 {
+		return createHeader(info)
+	}
 
-	copyOctal(header, 136, 12, uint64(stat.ModTime().Unix()))
+	data := []byte(strings.Join(records, ""))
 
-	if stat.IsDir() {
-		return nil, fmt.Errorf("don't know how to pack directories")
+	dir, base := path.Split(strings.TrimSuffix(info.fileName, "/"))
+	pax := &fileInfo{
+		fileName:    truncate(path.Join(dir, "PaxHeaders", base), 100),
+		fileMode:    0644,
+		fileSize:    uint64(len(data)),
+		lastModDate: info.lastModDate,
+		typeFlag:    typePAX,
 	}
-	// header[156] = 0x00 // normal file
 
-	// copyText(header, 257, 6, "ustar")
-	// copyText(header, 265, 32, "dominik")
-	// copyText(header, 297, 32, "dominik")
+	raw := createHeader(pax)
+	raw = append(raw, padBlock(data)...)
+
+	return append(raw, createHeader(info)...)
+}
+
+// paxRecords returns the extended header records of all fields of info that
+// the ustar header cannot hold.
+func paxRecords(info *fileInfo) []string {
+
+	records := []string{}
+
+	if _, _, ok := splitName(info.fileName); !ok {
+		records = append(records, paxRecord("path", info.fileName))
+	}
+	if len(info.linkName) > 100 {
+		records = append(records, paxRecord("linkpath", info.linkName))
+	}
+	if len(info.ownerUserName) > 32 {
+		records = append(records, paxRecord("uname", info.ownerUserName))
+	}
+	if len(info.ownerGroupName) > 32 {
+		records = append(records, paxRecord("gname", info.ownerGroupName))
+	}
+
+	return records
+}
+
+// paxRecord formats "<length> <key>=<value>\n", where length counts the
+// whole record including its own digits.
+func paxRecord(key, value string) string {
+	rest := " " + key + "=" + value + "\n"
+	size := len(rest)
+	for size < len(rest)+len(strconv.Itoa(size)) {
+		size = len(rest) + len(strconv.Itoa(size))
+	}
+	return strconv.Itoa(size) + rest
+}
+
+// splitName splits name into the ustar prefix and name fields.
+func splitName(name string) (string, string, bool) {
+
+	if len(name) <= 100 {
+		return "", name, true
+	}
+
+	for i := len(name) - 1; i > 0; i-- {
+		if name[i] != '/' || i == len(name)-1 {
+			continue
+		}
+		if len(name)-i-1 > 100 {
+			break
+		}
+		if i <= 155 {
+			return name[:i], name[i+1:], true
+		}
+	}
+
+	return "", "", false
+}
+
+func createHeader(info *fileInfo) []byte {
+	header := make([]byte, 512)
+
+	prefix, name, ok := splitName(info.fileName)
+	if !ok {
+		// the PAX header holds the full name
+		prefix, name = "", truncate(info.fileName, 100)
+	}
+
+	copyText(header, 0, 100, name)
+	copyOctal(header, 100, 8, info.fileMode)
+	copyNumeric(header, 108, 8, int64(info.ownerUserID))
+	copyNumeric(header, 116, 8, int64(info.ownerGroupID))
+	copyNumeric(header, 124, 12, int64(info.fileSize))
+	copyNumeric(header, 136, 12, info.lastModDate.Unix())
+	header[156] = info.typeFlag
+	copyText(header, 157, 100, truncate(info.linkName, 100))
+	copyText(header, 257, 6, "ustar\x00")
+	copyText(header, 263, 2, "00")
+	copyText(header, 265, 32, truncate(info.ownerUserName, 32))
+	copyText(header, 297, 32, truncate(info.ownerGroupName, 32))
+	copyText(header, 345, 155, prefix)
 
 	checksum := calcCheckSum[uint64](header)
-	copyOctal(header, 148, 6, checksum)
+	copyOctal(header, 148, 7, checksum)
 	header[155] = ' '
 
-	return header, nil
+	return header
 }
 
 func copyText(header []byte, offset, size uint64, val string) {
@@ -52,22 +372,35 @@ func copyOctal(header []byte, offset, size uint64, val uint64) {
 	copyText(header, offset, size-1, s)
 }
 
-func pack(path string) ([]byte, error) {
-
-	tar, err := createHeader(path)
-	if err != nil {
-		return nil, err
+// copyNumeric writes val in octal, or in the GNU base-256 encoding if it is
+// negative or too large for an octal field of size bytes.
+func copyNumeric(header []byte, offset, size uint64, val int64) {
+	if val >= 0 && uint64(val) <= maxOctal(size) {
+		copyOctal(header, offset, size, uint64(val))
+		return
 	}
 
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
+	field := header[offset : offset+size]
+	for i := len(field) - 1; i >= 0; i-- {
+		field[i] = byte(val)
+		val >>= 8
 	}
-	tar = append(tar, data...)
+	field[0] |= 0x80
+}
 
-	padding := make([]byte, 512-(uint64(len(data))%512))
-	tar = append(tar, padding...)
+// maxOctal returns the largest value an octal field of size bytes can hold.
+func maxOctal(size uint64) uint64 {
+	return 1<<(3*(size-1)) - 1
+}
 
-	return tar, nil
+func truncate(s string, size int) string {
+	if len(s) > size {
+		return s[:size]
+	}
+	return s
+}
 
+// padBlock pads data with zeros to a multiple of the block size.
+func padBlock(data []byte) []byte {
+	return append(data, make([]byte, 512*ceil512(uint64(len(data)))-uint64(len(data)))...)
 }
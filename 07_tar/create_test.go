@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testhelper_chdir changes into dir until the test ends.
+func testhelper_chdir(t *testing.T, dir string) {
+	t.Helper()
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(cwd) })
+}
+
+// testhelper_members returns the headers of all members of raw in order.
+func testhelper_members(t *testing.T, raw []byte) []*fileInfo {
+	t.Helper()
+
+	arch := newArchive(bytes.NewReader(raw))
+	members := []*fileInfo{}
+	for {
+		info, err := arch.next()
+		if err == io.EOF {
+			return members
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		members = append(members, info)
+	}
+}
+
+func TestSplitName(t *testing.T) {
+	long := strings.Repeat("d", 120)
+	tests := []struct {
+		name   string
+		prefix string
+		base   string
+		ok     bool
+	}{
+		{"short", "", "short", true},
+		{strings.Repeat("n", 100), "", strings.Repeat("n", 100), true},
+		{long + "/file", long, "file", true},
+		{"a/" + long + "/file", "a/" + long, "file", true},
+		{strings.Repeat("n", 101), "", "", false},
+		{"dir/" + strings.Repeat("n", 101), "", "", false},
+		{strings.Repeat("d", 156) + "/file", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name[:min(len(tt.name), 20)], func(t *testing.T) {
+			prefix, base, ok := splitName(tt.name)
+			if ok != tt.ok || (ok && (prefix != tt.prefix || base != tt.base)) {
+				t.Fatalf("have %q, %q, %v, want %q, %q, %v", prefix, base, ok, tt.prefix, tt.base, tt.ok)
+			}
+		})
+	}
+}
+
+func TestLongNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		info     fileInfo
+		wantsPAX bool
+	}{
+		{"ustar", fileInfo{fileName: "dir/file", typeFlag: typeRegular}, false},
+		{"prefix split", fileInfo{fileName: strings.Repeat("d", 120) + "/file", typeFlag: typeRegular}, false},
+		{"PAX path", fileInfo{fileName: "dir/" + strings.Repeat("n", 150), typeFlag: typeRegular}, true},
+		{"PAX directory", fileInfo{fileName: strings.Repeat("d/", 150), typeFlag: typeDirectory}, true},
+		{"PAX linkpath", fileInfo{fileName: "link", linkName: strings.Repeat("t/", 60), typeFlag: typeSymlink}, true},
+		{"PAX user name", fileInfo{fileName: "file", ownerUserName: strings.Repeat("u", 40), typeFlag: typeRegular}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := tt.info
+			info.fileMode = 0644
+
+			raw := createHeaders(&info)
+			if hasPAX := raw[156] == typePAX; hasPAX != tt.wantsPAX {
+				t.Errorf("PAX header written: %v, want %v", hasPAX, tt.wantsPAX)
+			}
+
+			members := testhelper_members(t, testhelper_archive(raw))
+			if len(members) != 1 {
+				t.Fatalf("have %d members", len(members))
+			}
+			have := members[0]
+			if have.filename() != info.fileName || have.linkName != info.linkName ||
+				have.ownerUserName != info.ownerUserName || have.typeFlag != info.typeFlag {
+				t.Fatalf("have %q -> %q (%q, type %c)", have.filename(), have.linkName, have.ownerUserName, have.typeFlag)
+			}
+		})
+	}
+}
+
+func TestPack(t *testing.T) {
+
+	dir := t.TempDir()
+	testhelper_chdir(t, dir)
+
+	if err := os.MkdirAll("tree/sub", 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("tree/sub/file", []byte("data"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link("tree/sub/file", "tree/sub/hard"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("sub/file", "tree/link"); err != nil {
+		t.Fatal(err)
+	}
+
+	// independent of the umask
+	for name, mode := range map[string]os.FileMode{"tree": 0755, "tree/sub": 0750, "tree/sub/file": 0640} {
+		if err := os.Chmod(name, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	p := newPacker(buf)
+	if err := p.pack("tree"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	members := map[string]*fileInfo{}
+	for _, info := range testhelper_members(t, buf.Bytes()) {
+		members[info.filename()] = info
+	}
+
+	tests := []struct {
+		name     string
+		typeFlag byte
+		mode     uint64
+		size     uint64
+		link     string
+	}{
+		{"tree/", typeDirectory, 0755, 0, ""},
+		{"tree/sub/", typeDirectory, 0750, 0, ""},
+		{"tree/sub/file", typeRegular, 0640, 4, ""},
+		{"tree/sub/hard", typeHardLink, 0640, 0, "tree/sub/file"},
+		{"tree/link", typeSymlink, 0777, 0, "sub/file"},
+	}
+	if len(members) != len(tests) {
+		t.Errorf("have %d members, want %d", len(members), len(tests))
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, ok := members[tt.name]
+			if !ok {
+				t.Fatal("missing")
+			}
+			if info.typeFlag != tt.typeFlag || info.fileSize != tt.size || info.linkName != tt.link {
+				t.Errorf("have type %c, size %d, link %q", info.typeFlag, info.fileSize, info.linkName)
+			}
+			if info.fileMode != tt.mode {
+				t.Errorf("have mode %o, want %o", info.fileMode, tt.mode)
+			}
+			if info.ownerUserID != uint64(os.Getuid()) || info.ownerGroupID != uint64(os.Getgid()) {
+				t.Errorf("have owner %d/%d, want %d/%d", info.ownerUserID, info.ownerGroupID, os.Getuid(), os.Getgid())
+			}
+		})
+	}
+}
+
+func TestPackSkipsArchive(t *testing.T) {
+
+	dir := t.TempDir()
+	testhelper_chdir(t, dir)
+
+	if err := os.WriteFile("file", []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(dir, "self.tar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	p := newPacker(buf)
+	p.exclude(stat)
+	if err := p.pack("."); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, info := range testhelper_members(t, buf.Bytes()) {
+		if info.filename() == "self.tar" {
+			t.Fatal("the archive archived itself")
+		}
+	}
+}
@@ -1,47 +1,45 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
-func unpack(tar []byte) ([]file, error) {
-
-	files := make([]file, 0)
-
-	arch := archive{raw: tar, ptr: 0}
+// archive reads a tar stream one header at a time. After next returned a
+// header, Read returns the data of that file.
+type archive struct {
+	r   io.Reader
+	ptr uint64
 
-	for {
-		eof, err := arch.eof()
-		if err != nil {
-			return nil, err
-		}
+	// remaining and padding count the unread data bytes of the current file
+	remaining uint64
+	padding   uint64
 
-		if eof {
-			return files, nil
-		}
+	// pax holds the extended header records for the next file
+	pax map[string]string
 
-		f, err := arch.parseFile()
-		if err != nil {
-			return nil, err
-		}
+	// longName and longLink hold the GNU long name records for the next file
+	longName, longLink string
 
-		files = append(files, f)
-	}
-}
+	// end is the offset of the end-of-archive marker once next returned
+	// io.EOF, where new members can be appended
+	end uint64
 
-type archive struct {
-	raw   []byte
-	ptr   uint64
-	files []file
+	// ignoreErrors skips damaged headers and zero blocks instead of failing
+	// or stopping, damaged counts the skipped headers
+	ignoreErrors bool
+	damaged      int
+	scanning     bool
 }
 
-type file struct {
-	info *fileInfo
-	data []byte
+func newArchive(r io.Reader) *archive {
+	return &archive{r: bufio.NewReader(r)}
 }
 
 type fileInfo struct {
@@ -64,94 +62,216 @@ type fileInfo struct {
 }
 
 func (i *fileInfo) filename() string {
-	return i.fileNamePrefix + i.fileName
+	if i.fileNamePrefix != "" {
+		return i.fileNamePrefix + "/" + i.fileName
+	}
+	return i.fileName
 }
 
-func (a *archive) checkOffset(offset uint64) error {
-	if a.ptr+offset < a.size() {
-		return nil
+// next skips the rest of the current file and returns the header of the
+// next one, or io.EOF at the end of the archive.
+func (a *archive) next() (*fileInfo, error) {
+
+	if err := a.skip(a.remaining + a.padding); err != nil {
+		return nil, err
 	}
-	return fmt.Errorf("unexpected end of archive: pos = %d, len = %d", a.ptr+offset, a.size())
-}
+	a.remaining, a.padding = 0, 0
 
-func (a *archive) size() uint64 {
-	return uint64(len(a.raw))
-}
+	for {
+		header, err := a.pop(512)
+		if err == io.EOF {
+			// archives truncated to the last file are accepted
+			a.end = a.ptr
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, err
+		}
 
-func (a *archive) eof() (bool, error) {
+		offset := a.ptr - 512
 
-	next, err := a.peek(1024)
-	if err != nil {
-		return true, err
-	}
+		if isZero(header) {
+			if a.ignoreErrors {
+				continue
+			}
 
-	for _, b := range next {
-		if b != 0x00 {
-			return false, nil
+			a.end = offset
+
+			// the end of the archive is marked by two zero blocks
+			if second, err := a.pop(512); err == nil && !isZero(second) {
+				fmt.Fprintln(os.Stderr, "[WARNING] lone zero block, ignoring the rest of the archive")
+			}
+			return nil, io.EOF
 		}
-	}
 
-	return true, nil
-}
+		info, err := parseHeader(header)
+		if err != nil {
+			err = fmt.Errorf("damaged header of %q at offset %d: %w", parseText(header, 0, 100), offset, err)
+			if !a.ignoreErrors {
+				return nil, err
+			}
+
+			// scan block by block for the next valid header
+			if !a.scanning {
+				fmt.Fprintf(os.Stderr, "[WARNING] %s, skipping to next header\n", err.Error())
+				a.damaged++
+			}
+			a.scanning = true
+			continue
+		}
 
-func (a *archive) pop(n uint64) ([]byte, error) {
-	if err := a.checkOffset(n); err != nil {
-		return nil, err
+		if a.scanning {
+			fmt.Fprintf(os.Stderr, "[INFO] found next header at offset %d\n", offset)
+			a.scanning = false
+		}
+
+		switch info.typeFlag {
+		case typePAX:
+			a.setData(info.fileSize)
+			data, err := io.ReadAll(a)
+			if err != nil {
+				return nil, err
+			}
+			if a.pax, err = parsePAX(data); err != nil {
+				return nil, err
+			}
+		case typeGlobalPAX:
+			// global defaults are not supported and ignored
+			a.setData(info.fileSize)
+		case typeGNULongName, typeGNULongLink:
+			a.setData(info.fileSize)
+			data, err := io.ReadAll(a)
+			if err != nil {
+				return nil, err
+			}
+			if info.typeFlag == typeGNULongName {
+				a.longName = parseText(data, 0, uint64(len(data)))
+			} else {
+				a.longLink = parseText(data, 0, uint64(len(data)))
+			}
+		default:
+			if a.longName != "" {
+				info.fileNamePrefix, info.fileName = "", a.longName
+			}
+			if a.longLink != "" {
+				info.linkName = a.longLink
+			}
+			a.longName, a.longLink = "", ""
+
+			if err := info.applyPAX(a.pax); err != nil {
+				return nil, err
+			}
+			a.pax = nil
+
+			// the size is only known once the extended headers are applied
+			if info.hasData() {
+				a.setData(info.fileSize)
+			}
+			return info, nil
+		}
+
+		if err := a.skip(a.remaining + a.padding); err != nil {
+			return nil, err
+		}
+		a.remaining, a.padding = 0, 0
 	}
+}
 
-	a.ptr += n
-	return a.raw[a.ptr-n : a.ptr], nil
+// setData makes the next size bytes and their padding the data of the
+// current entry.
+func (a *archive) setData(size uint64) {
+	a.remaining = size
+	a.padding = 512*ceil512(size) - size
 }
 
-func (a *archive) peek(n uint64) ([]byte, error) {
-	if err := a.checkOffset(n); err != nil {
-		return nil, err
+// damage returns an error if damaged headers were skipped.
+func (a *archive) damage() error {
+	if a.damaged > 0 {
+		return fmt.Errorf("skipped %d damaged headers", a.damaged)
 	}
-	return a.raw[a.ptr : a.ptr+n], nil
+	return nil
 }
 
-func (a *archive) parseFile() (file, error) {
+// Read reads the data of the current file.
+func (a *archive) Read(p []byte) (int, error) {
 
-	info, err := a.parseHeader()
-	if err != nil {
-		return file{}, err
+	if a.remaining == 0 {
+		return 0, io.EOF
 	}
 
-	data, err := a.parseData(info.fileSize)
-	if err != nil {
-		return file{}, err
+	if uint64(len(p)) > a.remaining {
+		p = p[:a.remaining]
+	}
+
+	n, err := a.r.Read(p)
+	a.ptr += uint64(n)
+	a.remaining -= uint64(n)
+
+	if err == io.EOF {
+		return n, a.unexpectedEOF()
 	}
 
-	return file{info: info, data: data}, nil
+	return n, err
 }
 
-func (a *archive) parseData(size uint64) ([]byte, error) {
+// pop reads the next n bytes. It returns io.EOF only if the archive ends
+// right before them.
+func (a *archive) pop(n uint64) ([]byte, error) {
 
-	blocks := ceil512(size)
+	raw := make([]byte, n)
+	m, err := io.ReadFull(a.r, raw)
+	a.ptr += uint64(m)
 
-	padded, err := a.pop(512 * blocks)
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err == io.ErrUnexpectedEOF {
+		return nil, a.unexpectedEOF()
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return padded[:size], nil
+	return raw, nil
 }
 
-func (a *archive) parseHeader() (*fileInfo, error) {
+func (a *archive) skip(n uint64) error {
+	m, err := io.CopyN(io.Discard, a.r, int64(n))
+	a.ptr += uint64(m)
+	if err == io.EOF {
+		return a.unexpectedEOF()
+	}
+	return err
+}
 
-	header, err := a.pop(512)
-	if err != nil {
-		return nil, err
+func (a *archive) unexpectedEOF() error {
+	return fmt.Errorf("unexpected end of archive: pos = %d", a.ptr)
+}
+
+// hasData reports whether the header is followed by the file contents.
+// Links, devices, directories and FIFOs never are, whatever their size field
+// says.
+func (i *fileInfo) hasData() bool {
+	switch i.typeFlag {
+	case typeHardLink, typeSymlink, typeChar, typeBlock, typeDirectory, typeFIFO:
+		return false
+	}
+	return true
+}
+
+func isZero(block []byte) bool {
+	for _, b := range block {
+		if b != 0x00 {
+			return false
+		}
 	}
+	return true
+}
+
+func parseHeader(header []byte) (*fileInfo, error) {
 
 	info := new(fileInfo)
 	info.fileName = parseText(header, 0, 100)
-	info.fileMode = parseOctal(header, 100, 7)
-	info.ownerUserID = parseOctal(header, 108, 7)
-	info.ownerGroupID = parseOctal(header, 116, 7)
-	info.fileSize = parseOctal(header, 124, 11)
-	info.lastModDate = parseTime(header, 136, 11)
-	info.checkSum = parseOctal(header, 148, 6)
 	info.linkName = parseText(header, 157, 100)
 	info.typeFlag = header[156]
 	info.ustarFlag = parseText(header, 257, 5) == "ustar"
@@ -162,39 +282,166 @@ func (a *archive) parseHeader() (*fileInfo, error) {
 	info.deviceMinorNumber = parseText(header, 337, 8)
 	info.fileNamePrefix = parseText(header, 345, 155)
 
+	checkSum, err := parseNumeric(header, 148, 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid checksum field: %w", err)
+	}
+	info.checkSum = uint64(checkSum)
+
 	if err := verifyChecksum(info.checkSum, header); err != nil {
-		fmt.Fprintf(os.Stderr, "[WARNING] tar-ball possibly corrupted: %s\n", err.Error())
+		return nil, err
 	}
 
+	fields := []struct {
+		name         string
+		offset, size uint64
+		val          *uint64
+	}{
+		{"mode", 100, 8, &info.fileMode},
+		{"uid", 108, 8, &info.ownerUserID},
+		{"gid", 116, 8, &info.ownerGroupID},
+		{"size", 124, 12, &info.fileSize},
+	}
+	for _, field := range fields {
+		val, err := parseNumeric(header, field.offset, field.size)
+		if err == nil && val < 0 {
+			err = fmt.Errorf("negative value %d", val)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s field: %w", field.name, err)
+		}
+		*field.val = uint64(val)
+	}
+
+	mtime, err := parseNumeric(header, 136, 12)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mtime field: %w", err)
+	}
+	info.lastModDate = time.Unix(mtime, 0)
+
 	return info, nil
 }
 
 func verifyChecksum(want uint64, header []byte) error {
-	if want == calcCheckSum[uint64](header) {
+
+	unsigned := calcCheckSum[uint64](header)
+	if want == unsigned {
 		return nil
 	}
 
-	if int64(want) == calcCheckSum[int64](header) {
+	// some old tars summed the bytes as signed chars
+	signed := int64(0)
+	for i, v := range header {
+		if i >= 148 && i < (148+8) {
+			signed += 32
+		} else {
+			signed += int64(int8(v))
+		}
+	}
+	if int64(want) == signed {
 		return nil
 	}
 
-	return fmt.Errorf("checksum verification failed")
+	return fmt.Errorf("checksum mismatch: stored %d, computed %d", want, unsigned)
 }
 
-func parseOctal(header []byte, offset uint64, size uint64) uint64 {
-	octal := string(header[offset : offset+size])
-	s, _ := strconv.ParseUint(octal, 8, 64)
-	return s
-}
+// parseNumeric parses an octal field or, if the high bit of its first byte
+// is set, a base-256 field as written by GNU tar for values that do not fit.
+func parseNumeric(header []byte, offset uint64, size uint64) (int64, error) {
 
-func parseTime(header []byte, offset uint64, size uint64) time.Time {
-	octal := string(header[offset : offset+size])
-	t, _ := strconv.ParseInt(octal, 8, 64)
-	return time.Unix(t, 0)
+	field := header[offset : offset+size]
+
+	if field[0]&0x80 != 0 {
+		// two's complement, big-endian, without the marker bit
+		inv := byte(0)
+		if field[0]&0x40 != 0 {
+			inv = 0xFF
+		}
+		x := uint64(0)
+		for i, c := range field {
+			c ^= inv
+			if i == 0 {
+				c &= 0x7F
+			}
+			if x>>56 != 0 {
+				return 0, fmt.Errorf("base-256 value overflows")
+			}
+			x = x<<8 | uint64(c)
+		}
+		if x>>63 != 0 {
+			return 0, fmt.Errorf("base-256 value overflows")
+		}
+		if inv == 0xFF {
+			return ^int64(x), nil
+		}
+		return int64(x), nil
+	}
+
+	octal := strings.Trim(string(field), " \x00")
+	if octal == "" {
+		return 0, nil
+	}
+
+	val, err := strconv.ParseInt(octal, 8, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an octal number", octal)
+	}
+
+	return val, nil
 }
 
+// parseText returns the field up to its first NUL byte.
 func parseText(header []byte, offset uint64, size uint64) string {
 	raw := header[offset : offset+size]
-	stripped := bytes.ReplaceAll(raw, []byte{0x00}, []byte{})
-	return string(stripped)
+	if i := bytes.IndexByte(raw, 0x00); i >= 0 {
+		raw = raw[:i]
+	}
+	return string(raw)
+}
+
+// parsePAX parses the records "<length> <key>=<value>\n" of an extended header.
+func parsePAX(data []byte) (map[string]string, error) {
+
+	records := map[string]string{}
+
+	for len(data) > 0 {
+		length, _, ok := bytes.Cut(data, []byte(" "))
+		size, err := strconv.Atoi(string(length))
+		if !ok || err != nil || size <= len(length)+1 || size > len(data) || data[size-1] != '\n' {
+			return nil, fmt.Errorf("malformed PAX record")
+		}
+
+		key, value, ok := strings.Cut(string(data[len(length)+1:size-1]), "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed PAX record")
+		}
+		records[key] = value
+
+		data = data[size:]
+	}
+
+	return records, nil
+}
+
+// applyPAX overrides the header fields with the extended header records.
+func (i *fileInfo) applyPAX(records map[string]string) error {
+	for key, value := range records {
+		switch key {
+		case "path":
+			i.fileNamePrefix, i.fileName = "", value
+		case "linkpath":
+			i.linkName = value
+		case "uname":
+			i.ownerUserName = value
+		case "gname":
+			i.ownerGroupName = value
+		case "size":
+			size, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid PAX size %q", value)
+			}
+			i.fileSize = size
+		}
+	}
+	return nil
 }
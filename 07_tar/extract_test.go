@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testhelper_entry returns the header blocks and padded data of a regular
+// file.
+func testhelper_entry(name string, data string) []byte {
+	info := &fileInfo{
+		fileName:    name,
+		fileMode:    0644,
+		fileSize:    uint64(len(data)),
+		lastModDate: time.Unix(1700000000, 0),
+		typeFlag:    typeRegular,
+	}
+	return append(createHeaders(info), padBlock([]byte(data))...)
+}
+
+// testhelper_archive joins the entries and appends the end-of-archive marker.
+func testhelper_archive(entries ...[]byte) []byte {
+	raw := bytes.Join(entries, nil)
+	return append(raw, make([]byte, 1024)...)
+}
+
+// testhelper_read returns the name and data of every member left in arch.
+func testhelper_read(t *testing.T, arch *archive) map[string]string {
+	t.Helper()
+
+	members := map[string]string{}
+	for {
+		info, err := arch.next()
+		if err == io.EOF {
+			return members
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(arch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		members[info.filename()] = string(data)
+	}
+}
+
+func TestPAXSize(t *testing.T) {
+
+	// the ustar size field says 0, the PAX record 5
+	records := []byte(paxRecord("size", "5"))
+	pax := createHeader(&fileInfo{fileName: "PaxHeaders/a", fileMode: 0644, fileSize: uint64(len(records)), typeFlag: typePAX})
+	pax = append(pax, padBlock(records)...)
+
+	file := createHeader(&fileInfo{fileName: "a", fileMode: 0644, typeFlag: typeRegular})
+	file = append(file, padBlock([]byte("hello"))...)
+
+	raw := testhelper_archive(pax, file, testhelper_entry("b", "world"))
+
+	members := testhelper_read(t, newArchive(bytes.NewReader(raw)))
+	if members["a"] != "hello" || members["b"] != "world" || len(members) != 2 {
+		t.Fatalf("have %q", members)
+	}
+}
+
+func TestGNULongName(t *testing.T) {
+
+	name := strings.Repeat("d/", 60) + "file"
+	long := createHeader(&fileInfo{fileName: "././@LongLink", fileSize: uint64(len(name) + 1), typeFlag: typeGNULongName})
+	long = append(long, padBlock([]byte(name+"\x00"))...)
+
+	raw := testhelper_archive(long, testhelper_entry("truncated", "data"))
+
+	members := testhelper_read(t, newArchive(bytes.NewReader(raw)))
+	if members[name] != "data" || len(members) != 1 {
+		t.Fatalf("have %q", members)
+	}
+}
+
+func TestNumericRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset uint64
+		size   uint64
+		val    int64
+	}{
+		{"small size", 124, 12, 12345},
+		{"largest octal size", 124, 12, 1<<33 - 1},
+		{"size over 8 GiB", 124, 12, 9 << 30},
+		{"largest octal uid", 108, 8, 1<<21 - 1},
+		{"uid over 2^21", 108, 8, 1 << 21},
+		{"uid over 2^32", 108, 8, 1<<40 + 7},
+		{"mtime before 1970", 136, 12, -86400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := make([]byte, 512)
+			copyNumeric(header, tt.offset, tt.size, tt.val)
+
+			octal := tt.val >= 0 && uint64(tt.val) <= maxOctal(tt.size)
+			if isBase256 := header[tt.offset]&0x80 != 0; isBase256 == octal {
+				t.Errorf("base-256 encoding used: %v, want %v", isBase256, !octal)
+			}
+
+			have, err := parseNumeric(header, tt.offset, tt.size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have != tt.val {
+				t.Fatalf("have %d, want %d", have, tt.val)
+			}
+		})
+	}
+}
+
+func TestLargeHeader(t *testing.T) {
+
+	info := &fileInfo{
+		fileName:     "big",
+		fileMode:     0644,
+		ownerUserID:  1 << 21,
+		ownerGroupID: 1 << 22,
+		fileSize:     9 << 30,
+		lastModDate:  time.Unix(1700000000, 0),
+		typeFlag:     typeRegular,
+	}
+
+	parsed, err := parseHeader(createHeader(info))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.fileSize != info.fileSize || parsed.ownerUserID != info.ownerUserID || parsed.ownerGroupID != info.ownerGroupID {
+		t.Fatalf("have size %d, uid %d, gid %d", parsed.fileSize, parsed.ownerUserID, parsed.ownerGroupID)
+	}
+}
+
+func TestInvalidNumeric(t *testing.T) {
+	header := make([]byte, 512)
+	copy(header[124:], "12345678x")
+	if _, err := parseNumeric(header, 124, 12); err == nil {
+		t.Fatal("no error for an invalid octal digit")
+	}
+}
+
+func TestDamagedHeader(t *testing.T) {
+
+	raw := testhelper_archive(
+		testhelper_entry("a", "first"),
+		testhelper_entry("b", "second"),
+		testhelper_entry("c", "third"),
+	)
+
+	// flip a bit in the name of b, whose header starts at the third block
+	raw[1024+0] ^= 0x01
+
+	// strict mode names the entry and its offset
+	arch := newArchive(bytes.NewReader(raw))
+	if _, err := arch.next(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := arch.next()
+	if err == nil || !strings.Contains(err.Error(), "offset 1024") || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("have error %v, want checksum mismatch at offset 1024", err)
+	}
+
+	// the lenient mode skips the entry and counts it
+	arch = newArchive(bytes.NewReader(raw))
+	arch.ignoreErrors = true
+	members := testhelper_read(t, arch)
+	if members["a"] != "first" || members["c"] != "third" || len(members) != 2 {
+		t.Fatalf("have %q", members)
+	}
+	if arch.damaged != 1 {
+		t.Fatalf("have %d damaged headers, want 1", arch.damaged)
+	}
+	if err := arch.damage(); err == nil {
+		t.Fatal("no error for skipped headers")
+	}
+}
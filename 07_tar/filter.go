@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// filter is a compression codec the archive stream is passed through.
+// Registering a codec in filters makes it available to auto-detection.
+type filter interface {
+	// magic returns the bytes every compressed stream starts with
+	magic() []byte
+	newReader(r io.Reader) (io.ReadCloser, error)
+	newWriter(w io.Writer) (io.WriteCloser, error)
+}
+
+var filters = []filter{
+	gzipFilter{},
+}
+
+type gzipFilter struct{}
+
+func (gzipFilter) magic() []byte {
+	return []byte{0x1F, 0x8B}
+}
+
+func (gzipFilter) newReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+func (gzipFilter) newWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+// detectFilter returns the filter whose magic bytes start r, or nil for an
+// uncompressed stream.
+func detectFilter(r *bufio.Reader) filter {
+	for _, f := range filters {
+		magic := f.magic()
+		if head, err := r.Peek(len(magic)); err == nil && bytes.Equal(head, magic) {
+			return f
+		}
+	}
+	return nil
+}
+
+// decompressor reads an archive through a filter. Close reads the remaining
+// compressed data, so the codec verifies its trailer.
+type decompressor struct {
+	io.ReadCloser
+}
+
+func (d decompressor) Close() error {
+	if _, err := io.Copy(io.Discard, d.ReadCloser); err != nil {
+		return err
+	}
+	return d.ReadCloser.Close()
+}
+
+// openFilter returns a reader for the decompressed contents of r, using f or,
+// if f is nil, the filter detected from the magic bytes of r.
+func openFilter(r io.Reader, f filter) (io.ReadCloser, error) {
+
+	in := bufio.NewReader(r)
+
+	if f == nil {
+		f = detectFilter(in)
+	}
+
+	if f == nil {
+		return io.NopCloser(in), nil
+	}
+
+	dec, err := f.newReader(in)
+	if err != nil {
+		return nil, err
+	}
+
+	return decompressor{dec}, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testhelper_gzip compresses raw with the gzip filter.
+func testhelper_gzip(t *testing.T, raw []byte) []byte {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	zw, err := gzipFilter{}.newWriter(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zw.Write(raw); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetectFilter(t *testing.T) {
+	tests := []struct {
+		name  string
+		given []byte
+		want  filter
+	}{
+		{"tar", testhelper_archive(testhelper_entry("a", "data")), nil},
+		{"gzip", testhelper_gzip(t, testhelper_archive()), gzipFilter{}},
+		{"empty", nil, nil},
+		{"one byte", []byte{0x1F}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if have := detectFilter(bufio.NewReader(bytes.NewReader(tt.given))); have != tt.want {
+				t.Fatalf("have %v, want %v", have, tt.want)
+			}
+		})
+	}
+}
+
+func TestGzipRoundTrip(t *testing.T) {
+
+	dir := t.TempDir()
+	testhelper_chdir(t, dir)
+
+	if err := os.WriteFile("a", []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "x.tgz")
+	if err := create(options{archive: path, directory: dir, compress: gzipFilter{}}, []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(raw, gzipFilter{}.magic()) {
+		t.Fatal("archive is not gzip compressed")
+	}
+
+	// with -z and auto-detected
+	for _, compress := range []filter{gzipFilter{}, nil} {
+		in, err := openInput(options{archive: path, compress: compress})
+		if err != nil {
+			t.Fatal(err)
+		}
+		members := testhelper_read(t, newArchive(in))
+		if err := in.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if members["a"] != "hello" || len(members) != 1 {
+			t.Fatalf("have %q", members)
+		}
+	}
+}
+
+func TestGzipCorruptTrailer(t *testing.T) {
+
+	// like GNU tar, pad the archive to whole records, so the reader stops
+	// well before the trailer
+	raw := testhelper_archive(testhelper_entry("a", "data"))
+	raw = append(raw, make([]byte, 20*512-len(raw)%(20*512))...)
+	given := testhelper_gzip(t, raw)
+
+	// the CRC-32 is only read when the rest of the stream is drained
+	given[len(given)-8] ^= 0x01
+
+	in, err := openFilter(bytes.NewReader(given), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	members := testhelper_read(t, newArchive(in))
+	if members["a"] != "data" {
+		t.Fatalf("have %q", members)
+	}
+
+	if err := in.Close(); err == nil {
+		t.Fatal("corrupt trailer not detected")
+	}
+}
+
+func TestGzipTruncated(t *testing.T) {
+
+	raw := testhelper_archive(testhelper_entry("a", "data"))
+	raw = append(raw, make([]byte, 20*512-len(raw)%(20*512))...)
+	given := testhelper_gzip(t, raw)
+
+	in, err := openFilter(bytes.NewReader(given[:len(given)-4]), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testhelper_read(t, newArchive(in))
+
+	if err := in.Close(); err == nil {
+		t.Fatal("truncated stream not detected")
+	}
+}
+
+func TestAppendRejectsCompressed(t *testing.T) {
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "x.tar.gz")
+
+	if err := os.WriteFile(path, testhelper_gzip(t, testhelper_archive()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := appendArchive(options{archive: path, directory: dir}, nil, false); err == nil {
+		t.Fatal("appended to a compressed archive")
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// list prints the names of the members matching one of the patterns, or of
+// all members if none are given. With verbose, it prints a line per member
+// in the style of ls -l.
+func list(opts options, members []string) error {
+
+	in, err := openInput(opts)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	arch := newArchive(in)
+	arch.ignoreErrors = opts.ignoreErrors
+
+	sel := newSelection(members, opts.excludes)
+
+	for {
+		info, err := arch.next()
+		if err == io.EOF {
+			if err := in.Close(); err != nil {
+				return err
+			}
+			if err := sel.missing(); err != nil {
+				return err
+			}
+			return arch.damage()
+		}
+		if err != nil {
+			return err
+		}
+
+		if !sel.includes(info.filename()) {
+			continue
+		}
+
+		if opts.verbose {
+			fmt.Println(info.longFormat())
+		} else {
+			fmt.Println(info.filename())
+		}
+	}
+}
+
+// longFormat describes the member like GNU tar -tv does.
+func (i *fileInfo) longFormat() string {
+
+	user := i.ownerUserName
+	if user == "" {
+		user = strconv.FormatUint(i.ownerUserID, 10)
+	}
+	group := i.ownerGroupName
+	if group == "" {
+		group = strconv.FormatUint(i.ownerGroupID, 10)
+	}
+	owner := user + "/" + group
+
+	size := i.fileSize
+	if !i.hasData() {
+		size = 0
+	}
+
+	line := fmt.Sprintf("%s %s %*d %s %s",
+		i.modeString(), owner, max(18-len(owner), 1), size,
+		i.lastModDate.Format("2006-01-02 15:04"), i.filename())
+
+	switch i.typeFlag {
+	case typeSymlink:
+		line += " -> " + i.linkName
+	case typeHardLink:
+		line += " link to " + i.linkName
+	}
+
+	return line
+}
+
+// modeString formats the type and permissions like ls -l.
+func (i *fileInfo) modeString() string {
+
+	types := map[byte]byte{
+		typeHardLink:  'h',
+		typeSymlink:   'l',
+		typeChar:      'c',
+		typeBlock:     'b',
+		typeDirectory: 'd',
+		typeFIFO:      'p',
+	}
+
+	s := []byte("-rwxrwxrwx")
+	if t, ok := types[i.typeFlag]; ok {
+		s[0] = t
+	}
+
+	for bit := range 9 {
+		if i.fileMode&(1<<(8-bit)) == 0 {
+			s[bit+1] = '-'
+		}
+	}
+
+	special := []struct {
+		mask     uint64
+		pos      int
+		set, off byte
+	}{
+		{04000, 3, 's', 'S'},
+		{02000, 6, 's', 'S'},
+		{01000, 9, 't', 'T'},
+	}
+	for _, sp := range special {
+		if i.fileMode&sp.mask == 0 {
+			continue
+		}
+		if s[sp.pos] == '-' {
+			s[sp.pos] = sp.off
+		} else {
+			s[sp.pos] = sp.set
+		}
+	}
+
+	return string(s)
+}
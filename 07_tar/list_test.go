@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLongFormat(t *testing.T) {
+	mtime := time.Date(2024, 3, 1, 14, 5, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		info fileInfo
+		want string
+	}{
+		{
+			"regular",
+			fileInfo{fileName: "a.txt", fileMode: 0644, fileSize: 1234, typeFlag: typeRegular, ownerUserName: "alice", ownerGroupName: "staff"},
+			"-rw-r--r-- alice/staff    1234 2024-03-01 14:05 a.txt",
+		},
+		{
+			"numeric owner",
+			fileInfo{fileName: "a.txt", fileMode: 0600, fileSize: 5, typeFlag: typeRegular, ownerUserID: 1000, ownerGroupID: 100},
+			"-rw------- 1000/100          5 2024-03-01 14:05 a.txt",
+		},
+		{
+			"directory",
+			fileInfo{fileName: "dir/", fileMode: 0755, typeFlag: typeDirectory, ownerUserName: "root", ownerGroupName: "root"},
+			"drwxr-xr-x root/root         0 2024-03-01 14:05 dir/",
+		},
+		{
+			"symlink",
+			fileInfo{fileName: "link", fileMode: 0777, typeFlag: typeSymlink, linkName: "a.txt", ownerUserName: "root", ownerGroupName: "root"},
+			"lrwxrwxrwx root/root         0 2024-03-01 14:05 link -> a.txt",
+		},
+		{
+			"hard link",
+			fileInfo{fileName: "hard", fileMode: 0644, fileSize: 1234, typeFlag: typeHardLink, linkName: "a.txt", ownerUserName: "root", ownerGroupName: "root"},
+			"hrw-r--r-- root/root         0 2024-03-01 14:05 hard link to a.txt",
+		},
+		{
+			"long owner",
+			fileInfo{fileName: "f", fileMode: 0644, fileSize: 7, typeFlag: typeRegular, ownerUserName: "averyveryverylonguser", ownerGroupName: "group"},
+			"-rw-r--r-- averyveryverylonguser/group 7 2024-03-01 14:05 f",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := tt.info
+			info.lastModDate = mtime
+			if have := info.longFormat(); have != tt.want {
+				t.Fatalf("have %q\nwant %q", have, tt.want)
+			}
+		})
+	}
+}
+
+func TestModeString(t *testing.T) {
+	tests := []struct {
+		mode     uint64
+		typeFlag byte
+		want     string
+	}{
+		{0644, typeRegular, "-rw-r--r--"},
+		{0000, typeRegular, "----------"},
+		{04755, typeRegular, "-rwsr-xr-x"},
+		{04644, typeRegular, "-rwSr--r--"},
+		{02755, typeRegular, "-rwxr-sr-x"},
+		{02745, typeRegular, "-rwxr-Sr-x"},
+		{01777, typeDirectory, "drwxrwxrwt"},
+		{01776, typeDirectory, "drwxrwxrwT"},
+		{0660, typeChar, "crw-rw----"},
+		{0660, typeBlock, "brw-rw----"},
+		{0644, typeFIFO, "prw-r--r--"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			info := fileInfo{fileMode: tt.mode, typeFlag: tt.typeFlag}
+			if have := info.modeString(); have != tt.want {
+				t.Fatalf("have %s, want %s", have, tt.want)
+			}
+		})
+	}
+}
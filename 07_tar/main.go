@@ -1,84 +1,392 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
-	"io/fs"
+	"io"
 	"os"
+	"time"
 )
 
+// exit codes as used by GNU tar
+const (
+	exitError = 1
+	exitUsage = 2
+)
+
+// mustSucceed reports err and exits like GNU tar does.
 func mustSucceed(err error) {
 	if err != nil {
-		panic(err)
+		fmt.Fprintf(os.Stderr, "go-tar: %v\n", err)
+		os.Exit(exitError)
 	}
 }
 
+// options are the settings shared by all modes.
+type options struct {
+	archive   string
+	directory string
+	verbose   bool
+
+	// ignoreErrors skips damaged headers when reading instead of failing
+	ignoreErrors bool
+
+	// excludes keeps matching files out of the archive and matching members
+	// out of the output
+	excludes patterns
+
+	// compress is the filter the archive passes through, nil for none or,
+	// when reading, for auto-detection
+	compress filter
+}
+
 func main() {
 
-	archive := flag.String("file", "", "use archive file or device ARCHIVE")
-	doExtract := flag.Bool("extract", false, "extract files from an archive")
-	doCreate := flag.Bool("create", false, "create a new archive")
+	var opts options
+	var doExtract, doCreate, doList, doAppend, doUpdate, gzip bool
+	var excludeFrom, filesFrom string
+
+	stringFlag(&opts.archive, "-", "use archive file or device ARCHIVE, '-' for stdin/stdout", "f", "file")
+	stringFlag(&opts.directory, ".", "change to directory DIR before archiving or extracting files", "C", "directory")
+	boolFlag(&doExtract, "extract files from an archive", "x", "extract")
+	boolFlag(&doCreate, "create a new archive", "c", "create")
+	boolFlag(&doList, "list the contents of an archive", "t", "list")
+	boolFlag(&doAppend, "append files to the end of an archive", "r", "append")
+	boolFlag(&doUpdate, "only append files newer than copy in archive", "u", "update")
+	boolFlag(&opts.verbose, "verbosely list files processed", "v", "verbose")
+	boolFlag(&opts.ignoreErrors, "skip damaged headers instead of failing", "i", "ignore-errors")
+	boolFlag(&gzip, "filter the archive through gzip", "z", "gzip", "gunzip")
+	flag.Var(&opts.excludes, "exclude", "exclude files matching `PATTERN`, may be repeated")
+	stringFlag(&excludeFrom, "", "exclude the patterns listed in FILE", "X", "exclude-from")
+	stringFlag(&filesFrom, "", "get the names to create or extract from FILE, '-' for stdin", "T", "files-from")
+
+	flag.CommandLine.Parse(expandShortFlags(os.Args[1:]))
 
-	flag.Parse()
+	if gzip {
+		opts.compress = gzipFilter{}
+	}
 
-	if *doExtract && *doCreate {
-		panic("you may not specify more than one 'extract' or 'create' option")
+	modes := 0
+	for _, mode := range []bool{doExtract, doCreate, doList, doAppend, doUpdate} {
+		if mode {
+			modes++
+		}
+	}
+	if modes != 1 {
+		fmt.Fprintln(os.Stderr, "go-tar: you must specify exactly one of the 'extract', 'create', 'list', 'append' or 'update' options")
+		os.Exit(exitUsage)
 	}
 
-	if *doExtract {
-		mustSucceed(extract(*archive))
+	if filesFrom == "-" && opts.archive == "-" && !doCreate {
+		fmt.Fprintln(os.Stderr, "go-tar: the archive and the list of names cannot both be read from stdin")
+		os.Exit(exitUsage)
 	}
 
-	if *doCreate {
-		paths := flag.Args()
-		mustSucceed(create(*archive, paths))
+	paths := flag.Args()
+	if filesFrom != "" {
+		names, err := readLines(filesFrom)
+		mustSucceed(err)
+		paths = append(paths, names...)
+	}
+	if excludeFrom != "" {
+		excludes, err := readLines(excludeFrom)
+		mustSucceed(err)
+		opts.excludes = append(opts.excludes, excludes...)
+	}
+
+	switch {
+	case doExtract:
+		mustSucceed(extract(opts, paths))
+	case doCreate:
+		mustSucceed(create(opts, paths))
+	case doList:
+		mustSucceed(list(opts, paths))
+	case doAppend, doUpdate:
+		mustSucceed(appendArchive(opts, paths, doUpdate))
 	}
 }
 
-func create(archivepath string, filepaths []string) error {
+func boolFlag(p *bool, usage string, names ...string) {
+	for _, name := range names {
+		flag.BoolVar(p, name, false, usage)
+	}
+}
 
-	tar := make([]byte, 0)
+func stringFlag(p *string, value string, usage string, names ...string) {
+	for _, name := range names {
+		flag.StringVar(p, name, value, usage)
+	}
+}
 
-	for _, path := range filepaths {
+// expandShortFlags splits combined single-letter flags such as -xvf into
+// -x -v -f, so the value of the last one may follow as the next argument.
+func expandShortFlags(args []string) []string {
+	expanded := []string{}
+	for i, arg := range args {
+		if arg == "--" {
+			return append(expanded, args[i:]...)
+		}
+		if len(arg) > 2 && arg[0] == '-' && arg[1] != '-' && isShortFlagGroup(arg[1:]) {
+			for _, c := range arg[1:] {
+				expanded = append(expanded, "-"+string(c))
+			}
+			continue
+		}
+		expanded = append(expanded, arg)
+	}
+	return expanded
+}
 
-		raw, err := pack(path)
+func isShortFlagGroup(s string) bool {
+	for _, c := range s {
+		if flag.Lookup(string(c)) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func create(opts options, filepaths []string) error {
+
+	out := os.Stdout
+	if opts.archive != "-" {
+		f, err := os.Create(opts.archive)
 		if err != nil {
 			return err
 		}
+		defer f.Close()
+		out = f
+	}
 
-		tar = append(tar, raw...)
+	var zw io.WriteCloser = nopWriteCloser{out}
+	if opts.compress != nil {
+		var err error
+		if zw, err = opts.compress.newWriter(out); err != nil {
+			return err
+		}
 	}
 
-	tar = append(tar, make([]byte, 1024)...)
+	w := bufio.NewWriter(zw)
+	p := newPacker(w)
+	p.excludes = opts.excludes
+
+	if opts.verbose {
+		// keep stdout clean if the archive goes there
+		p.log = os.Stdout
+		if out == os.Stdout {
+			p.log = os.Stderr
+		}
+	}
 
-	return os.WriteFile(archivepath, tar, os.FileMode(0644))
+	if stat, err := out.Stat(); err == nil && stat.Mode().IsRegular() {
+		p.exclude(stat)
+	}
+
+	// like GNU tar, the names are relative to -C
+	if err := os.Chdir(opts.directory); err != nil {
+		return err
+	}
+
+	for _, path := range filepaths {
+		if err := p.pack(path); err != nil {
+			return err
+		}
+	}
+
+	if err := p.finish(); err != nil {
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	return out.Close()
 }
 
-func extract(archivename string) error {
+type nopWriteCloser struct {
+	io.Writer
+}
 
-	tar, err := os.ReadFile(archivename)
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// openInput opens the archive for reading and decompresses it. Closing it
+// fails if the compressed stream is corrupt.
+func openInput(opts options) (io.ReadCloser, error) {
+
+	var in io.ReadCloser = io.NopCloser(os.Stdin)
+	if opts.archive != "-" {
+		f, err := os.Open(opts.archive)
+		if err != nil {
+			return nil, err
+		}
+		in = f
+	}
+
+	r, err := openFilter(in, opts.compress)
 	if err != nil {
+		in.Close()
+		return nil, err
+	}
+
+	return &input{ReadCloser: r, file: in}, nil
+}
+
+type input struct {
+	io.ReadCloser
+	file io.Closer
+}
+
+func (i *input) Close() error {
+	err := i.ReadCloser.Close()
+	i.file.Close()
+	return err
+}
+
+// extract unpacks the members matching one of the patterns, or all of them
+// if none are given.
+func extract(opts options, members []string) error {
+
+	in, err := openInput(opts)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	arch := newArchive(in)
+	arch.ignoreErrors = opts.ignoreErrors
+
+	u, err := newUnpacker(opts.directory)
+	if err != nil {
+		return err
+	}
+
+	sel := newSelection(members, opts.excludes)
+
+	for {
+		info, err := arch.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if !sel.includes(info.filename()) {
+			continue
+		}
+
+		if opts.verbose {
+			fmt.Println(info.filename())
+		}
+
+		if err := u.unpack(info, arch); err != nil {
+			return err
+		}
+	}
+
+	if err := in.Close(); err != nil {
 		return err
 	}
 
-	files, err := unpack(tar)
+	if err := u.finish(); err != nil {
+		return err
+	}
+
+	if err := sel.missing(); err != nil {
+		return err
+	}
+
+	return arch.damage()
+}
+
+// appendArchive adds the files to the end of an existing archive, or with
+// update only those that are newer than their archived copy.
+func appendArchive(opts options, filepaths []string, update bool) error {
+
+	if opts.archive == "-" {
+		return fmt.Errorf("cannot append to stdin/stdout, an archive file is required")
+	}
+
+	if opts.compress != nil {
+		return fmt.Errorf("cannot append to compressed archives")
+	}
+
+	f, err := os.OpenFile(opts.archive, os.O_RDWR|os.O_CREATE, 0644)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
 
-	for _, f := range files {
-		name := f.info.filename()
-		perm := fs.FileMode(f.info.fileMode)
-		data := f.data
+	if detectFilter(bufio.NewReader(f)) != nil {
+		return fmt.Errorf("cannot append to compressed archives")
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
 
-		fmt.Println(name, perm)
+	arch := newArchive(f)
+	archived := map[string]time.Time{}
 
-		err := os.WriteFile(name, data, perm)
+	for {
+		info, err := arch.next()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
 			return err
 		}
+		archived[info.filename()] = info.lastModDate
+	}
+
+	// overwrite the end-of-archive marker
+	if err := f.Truncate(int64(arch.end)); err != nil {
+		return err
+	}
+	if _, err := f.Seek(int64(arch.end), io.SeekStart); err != nil {
+		return err
+	}
 
+	w := bufio.NewWriter(f)
+	p := newPacker(w)
+	p.excludes = opts.excludes
+
+	if opts.verbose {
+		p.log = os.Stdout
 	}
 
-	return nil
+	if stat, err := f.Stat(); err == nil {
+		p.exclude(stat)
+	}
+
+	// like GNU tar, the names are relative to -C
+	if err := os.Chdir(opts.directory); err != nil {
+		return err
+	}
+	if update {
+		p.archived = archived
+	}
+
+	for _, path := range filepaths {
+		if err := p.pack(path); err != nil {
+			return err
+		}
+	}
+
+	if err := p.finish(); err != nil {
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return f.Close()
 }
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testhelper_names returns the member names of the archive file in order.
+func testhelper_names(t *testing.T, path string) []string {
+	t.Helper()
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, info := range testhelper_members(t, raw) {
+		names = append(names, info.filename())
+	}
+	return names
+}
+
+func TestAppend(t *testing.T) {
+
+	dir := t.TempDir()
+	testhelper_chdir(t, dir)
+
+	for _, name := range []string{"a", "b", "c"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(dir, "x.tar")
+	opts := options{archive: path, directory: dir}
+
+	// appending to a missing archive creates it
+	if err := appendArchive(opts, []string{"a"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := appendArchive(opts, []string{"b"}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if have := testhelper_names(t, path); !slices.Equal(have, []string{"a", "b"}) {
+		t.Fatalf("have %q", have)
+	}
+
+	// the old end-of-archive marker is replaced, not kept in the middle
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) != 4*512+1024 {
+		t.Fatalf("have %d bytes, want %d", len(raw), 4*512+1024)
+	}
+	if !isZero(raw[len(raw)-1024:]) {
+		t.Fatal("archive does not end with two zero blocks")
+	}
+}
+
+func TestUpdate(t *testing.T) {
+
+	dir := t.TempDir()
+	testhelper_chdir(t, dir)
+
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, name := range []string{"a", "b"} {
+		if err := os.WriteFile(name, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(dir, "x.tar")
+	opts := options{archive: path, directory: dir}
+
+	if err := appendArchive(opts, []string{"a", "b"}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// b is newer than its archived copy, c is not archived, a is unchanged
+	if err := os.WriteFile("b", []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("c", []byte("c"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := appendArchive(opts, []string{"a", "b", "c"}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if have := testhelper_names(t, path); !slices.Equal(have, []string{"a", "b", "b", "c"}) {
+		t.Fatalf("have %q", have)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// patterns are shell wildcards matched against member names. It is a
+// flag.Value, so a flag may be given several times.
+type patterns []string
+
+func (p *patterns) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patterns) Set(pattern string) error {
+	*p = append(*p, pattern)
+	return nil
+}
+
+// selects returns the first pattern matching name or one of its leading
+// directories, so "src" selects everything below src/.
+func (p patterns) selects(name string) (string, bool) {
+	for _, pattern := range p {
+		if matchPath(pattern, name) {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// excludes reports whether a pattern matches any trailing part of name, so
+// "*.o" excludes object files in all directories, like GNU tar does.
+func (p patterns) excludes(name string) bool {
+	rest := strings.TrimSuffix(name, "/")
+	for {
+		if _, ok := p.selects(rest); ok {
+			return true
+		}
+		i := strings.IndexByte(rest, '/')
+		if i < 0 {
+			return false
+		}
+		rest = rest[i+1:]
+	}
+}
+
+// matchPath reports whether pattern matches name or one of its leading
+// directories. Wildcards do not match a '/'.
+func matchPath(pattern, name string) bool {
+	pattern = cleanName(pattern)
+	name = cleanName(name)
+	for {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		i := strings.LastIndexByte(name, '/')
+		if i < 0 {
+			return false
+		}
+		name = name[:i]
+	}
+}
+
+// cleanName removes what does not change the meaning of a member name, such
+// as a leading "./" or a trailing slash.
+func cleanName(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// readLines returns the non-empty lines of the file at path, or of stdin
+// for "-".
+func readLines(path string) ([]string, error) {
+
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	lines := []string{}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if line := strings.TrimSuffix(s.Text(), "\r"); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, s.Err()
+}
+
+// selection decides which archive members are extracted or listed.
+type selection struct {
+	members  patterns
+	excludes patterns
+
+	// found holds the member patterns that matched at least one member
+	found map[string]bool
+}
+
+func newSelection(members, excludes patterns) *selection {
+	return &selection{members: members, excludes: excludes, found: map[string]bool{}}
+}
+
+// includes reports whether the member name is selected. Without member
+// patterns, all members not excluded are.
+func (s *selection) includes(name string) bool {
+	if s.excludes.excludes(name) {
+		return false
+	}
+	if len(s.members) == 0 {
+		return true
+	}
+	pattern, ok := s.members.selects(name)
+	if ok {
+		s.found[pattern] = true
+	}
+	return ok
+}
+
+// missing returns an error naming the member patterns that matched nothing.
+func (s *selection) missing() error {
+	notFound := []string{}
+	for _, pattern := range s.members {
+		if !s.found[pattern] {
+			notFound = append(notFound, pattern)
+		}
+	}
+	if len(notFound) > 0 {
+		return fmt.Errorf("not found in archive: %s", strings.Join(notFound, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"src", "src", true},
+		{"src", "src/", true},
+		{"src", "src/a/b.go", true},
+		{"src/", "src/a", true},
+		{"./src", "src/a", true},
+		{"src", "srcs/a", false},
+		{"src/a", "src", false},
+		{"*.go", "main.go", true},
+		{"*.go", "src/main.go", false},
+		{"src/*.go", "src/main.go", true},
+		{"src/*", "src/a/b.go", true},
+		{"src/f[12].txt", "src/f2.txt", true},
+		{"src/f[12].txt", "src/f3.txt", false},
+		{"s?c", "src/x", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			if have := matchPath(tt.pattern, tt.name); have != tt.want {
+				t.Fatalf("have %v, want %v", have, tt.want)
+			}
+		})
+	}
+}
+
+func TestExcludes(t *testing.T) {
+	excludes := patterns{"*.o", "build", "src/tmp"}
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"a.o", true},
+		{"src/sub/a.o", true},
+		{"src/a.c", false},
+		{"build/", true},
+		{"src/build/out", true},
+		{"src/tmp/x", true},
+		{"other/src/tmp", true},
+		{"src/tmpfile", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if have := excludes.excludes(tt.name); have != tt.want {
+				t.Fatalf("have %v, want %v", have, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatternsFlag(t *testing.T) {
+	var p patterns
+	for _, pattern := range []string{"*.o", "tmp"} {
+		if err := p.Set(pattern); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !slices.Equal(p, patterns{"*.o", "tmp"}) || p.String() != "*.o,tmp" {
+		t.Fatalf("have %q", p)
+	}
+}
+
+func TestSelection(t *testing.T) {
+	tests := []struct {
+		name     string
+		members  patterns
+		excludes patterns
+		want     []string
+		missing  string
+	}{
+		{"all", nil, nil, []string{"src/", "src/a.c", "src/a.o", "doc/x.md"}, ""},
+		{"directory", patterns{"src"}, nil, []string{"src/", "src/a.c", "src/a.o"}, ""},
+		{"wildcard", patterns{"src/*.c"}, nil, []string{"src/a.c"}, ""},
+		{"exclude", patterns{"src"}, patterns{"*.o"}, []string{"src/", "src/a.c"}, ""},
+		{"not found", patterns{"doc", "nothing", "src/*.h"}, nil, []string{"doc/x.md"}, "nothing, src/*.h"},
+		{"only excluded", patterns{"src/a.o"}, patterns{"*.o"}, []string{}, "src/a.o"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sel := newSelection(tt.members, tt.excludes)
+
+			have := []string{}
+			for _, name := range []string{"src/", "src/a.c", "src/a.o", "doc/x.md"} {
+				if sel.includes(name) {
+					have = append(have, name)
+				}
+			}
+			if !slices.Equal(have, tt.want) {
+				t.Errorf("have %q, want %q", have, tt.want)
+			}
+
+			err := sel.missing()
+			switch {
+			case tt.missing == "" && err != nil:
+				t.Errorf("unexpected error %v", err)
+			case tt.missing != "" && (err == nil || !strings.HasSuffix(err.Error(), ": "+tt.missing)):
+				t.Errorf("have error %v, want %s not found", err, tt.missing)
+			}
+		})
+	}
+}
+
+func TestReadLines(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "list")
+	if err := os.WriteFile(path, []byte("src\n\n*.o\r\nname with spaces\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"src", "*.o", "name with spaces"}
+
+	have, err := readLines(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(have, want) {
+		t.Fatalf("have %q, want %q", have, want)
+	}
+
+	// "-" reads stdin
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	stdin := os.Stdin
+	os.Stdin = f
+	defer func() { os.Stdin = stdin }()
+
+	have, err = readLines("-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(have, want) {
+		t.Fatalf("have %q from stdin, want %q", have, want)
+	}
+
+	if _, err := readLines(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("no error for a missing file")
+	}
+}
+
+func TestPackExcludes(t *testing.T) {
+
+	dir := t.TempDir()
+	for _, name := range []string{"src/a.c", "src/a.o", "src/build/out", "doc/x.md"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+
+	buf := new(strings.Builder)
+	p := newPacker(buf)
+	p.excludes = patterns{"*.o", "build"}
+	for _, root := range []string{"src", "doc"} {
+		if err := p.pack(root); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	arch := newArchive(strings.NewReader(buf.String()))
+	have := []string{}
+	for name := range testhelper_read(t, arch) {
+		have = append(have, name)
+	}
+	slices.Sort(have)
+
+	want := []string{"doc/", "doc/x.md", "src/", "src/a.c"}
+	if !slices.Equal(have, want) {
+		t.Fatalf("have %q, want %q", have, want)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// unpacker extracts archive entries below root. It never follows a symlink
+// that leads outside of root, so neither hostile names nor links created by
+// earlier entries can make it write anywhere else.
+type unpacker struct {
+	root string
+
+	// dirs are restored last, so extracting their contents neither fails on
+	// read-only directories nor changes their mtime
+	dirs []extractedDir
+
+	skipped       int
+	strippedSlash bool
+}
+
+type extractedDir struct {
+	path string
+	info *fileInfo
+}
+
+func newUnpacker(root string) (*unpacker, error) {
+
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &unpacker{root: resolved}, nil
+}
+
+// unpack extracts the entry info with the data r. Unsafe entries are skipped
+// with a warning and reported by finish.
+func (u *unpacker) unpack(info *fileInfo, r io.Reader) error {
+
+	name, ok := u.sanitize(info.filename())
+	if !ok {
+		return nil
+	}
+
+	if name == "." {
+		// the root itself
+		if info.typeFlag == typeDirectory {
+			u.dirs = append(u.dirs, extractedDir{path: u.root, info: info})
+		}
+		return nil
+	}
+
+	dest, err := u.prepare(name, info.typeFlag == typeDirectory)
+	if err != nil {
+		return u.skip(info.filename(), err)
+	}
+
+	switch info.typeFlag {
+	case typeRegular, 0x00:
+		if err := writeFile(dest, r); err != nil {
+			return err
+		}
+		return restore(dest, info)
+
+	case typeDirectory:
+		if err := os.Mkdir(dest, 0700); err != nil && !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+		u.dirs = append(u.dirs, extractedDir{path: dest, info: info})
+		return nil
+
+	case typeSymlink:
+		// the link itself may point anywhere, it is never followed while
+		// extracting
+		return os.Symlink(info.linkName, dest)
+
+	case typeHardLink:
+		target, ok := u.sanitize(info.linkName)
+		if !ok {
+			return nil
+		}
+		parent, err := u.resolve(path.Dir(target))
+		if err != nil {
+			return u.skip(info.filename(), err)
+		}
+		src := filepath.Join(parent, path.Base(target))
+		if stat, err := os.Lstat(src); err != nil || stat.IsDir() {
+			return u.skip(info.filename(), fmt.Errorf("link target %s was not extracted", target))
+		}
+		return os.Link(src, dest)
+
+	default:
+		return u.skip(info.filename(), fmt.Errorf("cannot extract type '%c'", info.typeFlag))
+	}
+}
+
+// finish restores the directories and fails if any entry was skipped.
+func (u *unpacker) finish() error {
+
+	// children before parents
+	for i := len(u.dirs) - 1; i >= 0; i-- {
+		if err := restore(u.dirs[i].path, u.dirs[i].info); err != nil {
+			return err
+		}
+	}
+
+	if u.skipped > 0 {
+		return fmt.Errorf("%d entries were not extracted", u.skipped)
+	}
+
+	return nil
+}
+
+func (u *unpacker) skip(name string, err error) error {
+	fmt.Fprintf(os.Stderr, "[WARNING] %s: %s, skipping\n", name, err.Error())
+	u.skipped++
+	return nil
+}
+
+// sanitize makes name relative and rejects names that leave the root.
+func (u *unpacker) sanitize(name string) (string, bool) {
+
+	if strings.HasPrefix(name, "/") {
+		if !u.strippedSlash {
+			fmt.Fprintln(os.Stderr, "[INFO] removing leading '/' from member names")
+			u.strippedSlash = true
+		}
+		name = strings.TrimLeft(name, "/")
+	}
+
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			u.skip(name, fmt.Errorf("member name contains '..'"))
+			return "", false
+		}
+	}
+
+	name = path.Clean("/" + name)[1:]
+	if name == "" {
+		name = "."
+	}
+
+	return name, true
+}
+
+// prepare creates the missing parent directories of name and returns the
+// path to extract it to. Any existing non-directory at that path is removed,
+// so the entry replaces it instead of writing through it.
+func (u *unpacker) prepare(name string, isDir bool) (string, error) {
+
+	parent, err := u.resolve(path.Dir(name))
+	if err != nil {
+		return "", err
+	}
+
+	dest := filepath.Join(parent, path.Base(name))
+
+	stat, err := os.Lstat(dest)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return dest, nil
+	case err != nil:
+		return "", err
+	case stat.IsDir() && isDir:
+		return dest, nil
+	case stat.IsDir():
+		return "", fmt.Errorf("cannot replace directory %s", dest)
+	}
+
+	return dest, os.Remove(dest)
+}
+
+// resolve returns the real path of the directory name below the root,
+// creating missing directories on the way. It fails if a symlink leads
+// outside the root.
+func (u *unpacker) resolve(name string) (string, error) {
+
+	cur := u.root
+	if name == "." {
+		return cur, nil
+	}
+
+	for _, part := range strings.Split(name, "/") {
+
+		next := filepath.Join(cur, part)
+
+		stat, err := os.Lstat(next)
+		if errors.Is(err, fs.ErrNotExist) {
+			if err := os.Mkdir(next, 0755); err != nil {
+				return "", err
+			}
+			cur = next
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if stat.Mode()&fs.ModeSymlink != 0 {
+			resolved, err := filepath.EvalSymlinks(next)
+			if err != nil {
+				return "", err
+			}
+			if !u.contains(resolved) {
+				return "", fmt.Errorf("symlink %s leads outside of %s", next, u.root)
+			}
+			next = resolved
+		}
+
+		cur = next
+	}
+
+	return cur, nil
+}
+
+func (u *unpacker) contains(p string) bool {
+	rel, err := filepath.Rel(u.root, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+func writeFile(name string, r io.Reader) error {
+
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// restore sets permissions and modification time of an extracted file.
+func restore(name string, info *fileInfo) error {
+	if err := os.Chmod(name, info.mode()); err != nil {
+		return err
+	}
+	return os.Chtimes(name, info.lastModDate, info.lastModDate)
+}
+
+// mode converts the Unix mode bits of the header.
+func (i *fileInfo) mode() fs.FileMode {
+	m := fs.FileMode(i.fileMode).Perm()
+	if i.fileMode&04000 != 0 {
+		m |= fs.ModeSetuid
+	}
+	if i.fileMode&02000 != 0 {
+		m |= fs.ModeSetgid
+	}
+	if i.fileMode&01000 != 0 {
+		m |= fs.ModeSticky
+	}
+	return m
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testEntry struct {
+	name     string
+	typeFlag byte
+	link     string
+	data     string
+}
+
+// testhelper_unpack extracts the entries to a fresh root below a temporary
+// directory and returns both.
+func testhelper_unpack(t *testing.T, entries []testEntry) (*unpacker, string, string) {
+	t.Helper()
+
+	outside := t.TempDir()
+	root := filepath.Join(outside, "root")
+
+	u, err := newUnpacker(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range entries {
+		info := &fileInfo{
+			fileName:    e.name,
+			fileMode:    0644,
+			fileSize:    uint64(len(e.data)),
+			lastModDate: time.Unix(1700000000, 0),
+			typeFlag:    e.typeFlag,
+			linkName:    strings.ReplaceAll(e.link, "$OUTSIDE", outside),
+		}
+		if e.typeFlag == typeDirectory {
+			info.fileMode = 0755
+		}
+		if err := u.unpack(info, strings.NewReader(e.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return u, u.root, outside
+}
+
+func TestUnpack(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []testEntry
+		skipped int
+		exists  []string // below the root
+		absent  []string // below the directory containing the root
+	}{
+		{
+			name:    "dot-dot",
+			entries: []testEntry{{name: "../evil", typeFlag: typeRegular, data: "x"}},
+			skipped: 1,
+			absent:  []string{"evil"},
+		},
+		{
+			name:    "nested dot-dot",
+			entries: []testEntry{{name: "a/../../evil", typeFlag: typeRegular, data: "x"}},
+			skipped: 1,
+			absent:  []string{"evil", "root/a"},
+		},
+		{
+			name:    "absolute path",
+			entries: []testEntry{{name: "/evil", typeFlag: typeRegular, data: "x"}},
+			exists:  []string{"evil"},
+		},
+		{
+			name: "symlink to outside",
+			entries: []testEntry{
+				{name: "link", typeFlag: typeSymlink, link: "$OUTSIDE"},
+				{name: "link/evil", typeFlag: typeRegular, data: "x"},
+			},
+			skipped: 1,
+			absent:  []string{"evil"},
+		},
+		{
+			name: "relative symlink to outside",
+			entries: []testEntry{
+				{name: "link", typeFlag: typeSymlink, link: ".."},
+				{name: "link/evil", typeFlag: typeRegular, data: "x"},
+			},
+			skipped: 1,
+			absent:  []string{"evil"},
+		},
+		{
+			name: "symlinked parent directory",
+			entries: []testEntry{
+				{name: "a", typeFlag: typeDirectory},
+				{name: "a/up", typeFlag: typeSymlink, link: "../.."},
+				{name: "a/up/sub/evil", typeFlag: typeRegular, data: "x"},
+			},
+			skipped: 1,
+			absent:  []string{"sub"},
+		},
+		{
+			name: "symlinked parent directory inside the root",
+			entries: []testEntry{
+				{name: "real", typeFlag: typeDirectory},
+				{name: "alias", typeFlag: typeSymlink, link: "real"},
+				{name: "alias/file", typeFlag: typeRegular, data: "x"},
+			},
+			exists: []string{"real/file"},
+		},
+		{
+			name:    "hard link to outside",
+			entries: []testEntry{{name: "h", typeFlag: typeHardLink, link: "../evil"}},
+			skipped: 1,
+			absent:  []string{"root/h"},
+		},
+		{
+			name:    "hard link to a missing member",
+			entries: []testEntry{{name: "h", typeFlag: typeHardLink, link: "dir/missing"}},
+			skipped: 1,
+			absent:  []string{"root/h", "root/dir/missing"},
+		},
+		{
+			name: "hard link",
+			entries: []testEntry{
+				{name: "file", typeFlag: typeRegular, data: "x"},
+				{name: "h", typeFlag: typeHardLink, link: "file"},
+			},
+			exists: []string{"file", "h"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, root, outside := testhelper_unpack(t, tt.entries)
+
+			if u.skipped != tt.skipped {
+				t.Errorf("have %d skipped entries, want %d", u.skipped, tt.skipped)
+			}
+			for _, name := range tt.exists {
+				if _, err := os.Lstat(filepath.Join(root, name)); err != nil {
+					t.Error(err)
+				}
+			}
+			for _, name := range tt.absent {
+				if _, err := os.Lstat(filepath.Join(outside, name)); err == nil {
+					t.Errorf("%s was created", name)
+				}
+			}
+		})
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{"a/b", "a/b", true},
+		{"./a//b/", "a/b", true},
+		{"/etc/passwd", "etc/passwd", true},
+		{"//a", "a", true},
+		{".", ".", true},
+		{"..", "", false},
+		{"a/../b", "", false},
+		{"../../etc/passwd", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &unpacker{strippedSlash: true}
+			have, ok := u.sanitize(tt.name)
+			if have != tt.want || ok != tt.ok {
+				t.Fatalf("have %q, %v, want %q, %v", have, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
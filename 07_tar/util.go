@@ -20,3 +20,19 @@ func ceil512(size uint64) uint64 {
 	}
 	return blocks
 }
+
+// type flags of the ustar and PAX formats
+const (
+	typeRegular   = '0'
+	typeHardLink  = '1'
+	typeSymlink   = '2'
+	typeChar      = '3'
+	typeBlock     = '4'
+	typeDirectory = '5'
+	typeFIFO      = '6'
+	typePAX       = 'x'
+	typeGlobalPAX = 'g'
+
+	typeGNULongName = 'L'
+	typeGNULongLink = 'K'
+)
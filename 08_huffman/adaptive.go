@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// The adaptive mode uses the FGK algorithm: encoder and decoder start with
+// a tree that only holds the NYT (not yet transmitted) node and update it
+// identically after every symbol, so no code table has to be transmitted
+// and the input is read only once. A symbol seen for the first time is sent
+// as the code of the NYT node followed by its raw value in symbolBits bits.
+// The stream ends with the raw value endOfStream.
+
+const (
+	symbolBits  = 9
+	endOfStream = 256
+	maxNodes    = 2*(endOfStream+1) - 1
+)
+
+type adaptiveNode struct {
+	weight              uint64
+	symbol              int
+	number              int
+	parent, left, right *adaptiveNode
+}
+
+func (n *adaptiveNode) isLeaf() bool {
+	return n.left == nil
+}
+
+type adaptiveTree struct {
+	root, nyt *adaptiveNode
+	leaves    [endOfStream]*adaptiveNode
+
+	// byNumber orders the nodes by the sibling property: weights never
+	// decrease with the number and the root has the highest number
+	byNumber [maxNodes]*adaptiveNode
+}
+
+func newAdaptiveTree() *adaptiveTree {
+	t := &adaptiveTree{}
+	t.root = &adaptiveNode{symbol: -1, number: maxNodes - 1}
+	t.nyt = t.root
+	t.byNumber[t.root.number] = t.root
+	return t
+}
+
+// add splits the NYT node into a new NYT node and a leaf for symbol.
+func (t *adaptiveTree) add(symbol int) *adaptiveNode {
+
+	parent := t.nyt
+
+	nyt := &adaptiveNode{symbol: -1, number: parent.number - 2, parent: parent}
+	leaf := &adaptiveNode{symbol: symbol, number: parent.number - 1, parent: parent}
+
+	parent.left, parent.right = nyt, leaf
+
+	t.byNumber[nyt.number] = nyt
+	t.byNumber[leaf.number] = leaf
+	t.leaves[symbol] = leaf
+	t.nyt = nyt
+
+	return leaf
+}
+
+// update increments the weight of symbol and restores the sibling property.
+func (t *adaptiveTree) update(symbol int) {
+
+	n := t.leaves[symbol]
+	if n == nil {
+		n = t.add(symbol)
+	}
+
+	for ; n != nil; n = n.parent {
+
+		// move n to the highest number of all nodes with the same weight
+		leader := n
+		for i := n.number + 1; i < maxNodes && t.byNumber[i].weight == n.weight; i++ {
+			leader = t.byNumber[i]
+		}
+		if leader != n && leader != n.parent {
+			t.swap(n, leader)
+		}
+
+		n.weight++
+	}
+}
+
+// swap exchanges the positions of the subtrees a and b.
+func (t *adaptiveTree) swap(a, b *adaptiveNode) {
+
+	pa, pb := a.parent, b.parent
+
+	if pa == pb {
+		pa.left, pa.right = pa.right, pa.left
+	} else {
+		if pa.left == a {
+			pa.left = b
+		} else {
+			pa.right = b
+		}
+		if pb.left == b {
+			pb.left = a
+		} else {
+			pb.right = a
+		}
+		a.parent, b.parent = pb, pa
+	}
+
+	a.number, b.number = b.number, a.number
+	t.byNumber[a.number] = a
+	t.byNumber[b.number] = b
+}
+
+// code returns the path from the root to n, first bit first.
+func (t *adaptiveTree) code(n *adaptiveNode) []bool {
+	code := []bool{}
+	for ; n.parent != nil; n = n.parent {
+		code = append(code, n.parent.right == n)
+	}
+	for i, j := 0, len(code)-1; i < j; i, j = i+1, j-1 {
+		code[i], code[j] = code[j], code[i]
+	}
+	return code
+}
+
+func (t *adaptiveTree) writeSymbol(out *bitWriter, symbol int) error {
+
+	var n *adaptiveNode
+	if symbol < endOfStream {
+		n = t.leaves[symbol]
+	}
+
+	known := n != nil
+	if !known {
+		n = t.nyt
+	}
+
+	for _, bit := range t.code(n) {
+		b := uint64(0)
+		if bit {
+			b = 1
+		}
+		if err := out.writeBits(b, 1); err != nil {
+			return err
+		}
+	}
+
+	if !known {
+		return out.writeBits(uint64(symbol), symbolBits)
+	}
+
+	return nil
+}
+
+func (t *adaptiveTree) readSymbol(in *bitReader) (int, error) {
+
+	n := t.root
+	for !n.isLeaf() {
+		bit, err := in.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if bit {
+			n = n.right
+		} else {
+			n = n.left
+		}
+	}
+
+	if n != t.nyt {
+		return n.symbol, nil
+	}
+
+	symbol := 0
+	for i := range symbolBits {
+		bit, err := in.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if bit {
+			symbol |= 1 << i
+		}
+	}
+
+	if symbol > endOfStream || (symbol < endOfStream && t.leaves[symbol] != nil) {
+		return 0, fmt.Errorf("invalid symbol %d after NYT code", symbol)
+	}
+
+	return symbol, nil
+}
+
+// encodeAdaptive reads r once and writes its adaptive Huffman encoding to w.
+func encodeAdaptive(w io.Writer, r io.Reader) (int64, error) {
+
+	t := newAdaptiveTree()
+
+	in := bufio.NewReader(r)
+	out := newBitWriter(w)
+
+	size := int64(0)
+	for {
+		b, err := in.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return size, err
+		}
+		if err := t.writeSymbol(out, int(b)); err != nil {
+			return size, err
+		}
+		t.update(int(b))
+		size++
+	}
+
+	if err := t.writeSymbol(out, endOfStream); err != nil {
+		return size, err
+	}
+
+	return size, out.flush()
+}
+
+// decodeAdaptive decodes the adaptive Huffman stream r and writes it to w,
+// where h holds the checksum of the header bytes read so far.
+func decodeAdaptive(w io.Writer, r *bufio.Reader, h hash.Hash32) error {
+
+	if err := checkHeader(r, h); err != nil {
+		return err
+	}
+
+	t := newAdaptiveTree()
+
+	// the end of stream symbol marks the end, padding bits are never read
+	in := newBitReader(r, 0)
+	sum := crc32.NewIEEE()
+	out := bufio.NewWriter(io.MultiWriter(w, sum))
+
+	for {
+		symbol, err := t.readSymbol(in)
+		if err == io.EOF {
+			return fmt.Errorf("data ends before the end of stream symbol")
+		}
+		if err != nil {
+			return err
+		}
+		if symbol == endOfStream {
+			break
+		}
+		if err := out.WriteByte(byte(symbol)); err != nil {
+			return err
+		}
+		t.update(symbol)
+	}
+
+	if err := in.alignToByte(); err != nil {
+		return err
+	}
+
+	if err := out.Flush(); err != nil {
+		return err
+	}
+
+	return checkData(r, sum)
+}
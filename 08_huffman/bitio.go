@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// bitWriter packs codes into bytes, least-significant bit first.
+type bitWriter struct {
+	w   *bufio.Writer
+	acc uint64
+	n   uint
+}
+
+func newBitWriter(w io.Writer) *bitWriter {
+	return &bitWriter{w: bufio.NewWriter(w)}
+}
+
+// writeBits appends the n lowest bits of bits to the stream.
+func (bw *bitWriter) writeBits(bits uint64, n uint) error {
+	bw.acc |= (bits & (1<<n - 1)) << bw.n
+	bw.n += n
+	for bw.n >= 8 {
+		if err := bw.w.WriteByte(byte(bw.acc)); err != nil {
+			return err
+		}
+		bw.acc >>= 8
+		bw.n -= 8
+	}
+	return nil
+}
+
+// flush pads the last byte with zeros and writes all buffered data.
+func (bw *bitWriter) flush() error {
+	if bw.n > 0 {
+		if err := bw.w.WriteByte(byte(bw.acc)); err != nil {
+			return err
+		}
+		bw.acc, bw.n = 0, 0
+	}
+	return bw.w.Flush()
+}
+
+// padding returns the number of unused bits in the last byte of a stream of
+// the given number of bits.
+func padding(bits uint64) byte {
+	return byte((8 - bits%8) % 8)
+}
+
+// packCodes converts the canonical codes into the bit order of the stream,
+// so every code can be written with a single writeBits call.
+func packCodes(lut map[byte][]bool) (codes [256]uint64, lengths [256]uint) {
+	for symbol, code := range lut {
+		for i, bit := range code {
+			if bit {
+				codes[symbol] |= 1 << i
+			}
+		}
+		lengths[symbol] = uint(len(code))
+	}
+	return codes, lengths
+}
+
+// bitReader unpacks a stream written by bitWriter. The last rem bits of the
+// last byte are padding and are never returned.
+type bitReader struct {
+	r   *bufio.Reader
+	rem byte
+	cur byte
+	n   int
+}
+
+// newBitReader reads from r directly if it is a *bufio.Reader, so whatever
+// follows the bitstream can be read from r afterwards.
+func newBitReader(r io.Reader, rem byte) *bitReader {
+	in, ok := r.(*bufio.Reader)
+	if !ok {
+		in = bufio.NewReader(r)
+	}
+	return &bitReader{r: in, rem: rem}
+}
+
+func (br *bitReader) fill() error {
+
+	if br.n > 0 {
+		return nil
+	}
+
+	b, err := br.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	br.cur, br.n = b, 8
+
+	// peek ahead to find out whether this is the padded last byte
+	if _, err := br.r.Peek(1); err == io.EOF {
+		br.n -= int(br.rem)
+	} else if err != nil {
+		return err
+	}
+
+	if br.n <= 0 {
+		br.n = 0
+		return io.EOF
+	}
+
+	return nil
+}
+
+// eof reports whether all bits have been read.
+func (br *bitReader) eof() (bool, error) {
+	err := br.fill()
+	if err == io.EOF {
+		return true, nil
+	}
+	return false, err
+}
+
+// alignToByte discards the remaining bits of the current byte, which must
+// be zero padding.
+func (br *bitReader) alignToByte() error {
+	if br.cur != 0 {
+		return fmt.Errorf("nonzero padding bits")
+	}
+	br.n = 0
+	return nil
+}
+
+// readBit returns the next bit, or io.EOF if there are none left.
+func (br *bitReader) readBit() (bool, error) {
+
+	if err := br.fill(); err != nil {
+		return false, err
+	}
+
+	bit := br.cur&1 != 0
+	br.cur >>= 1
+	br.n--
+
+	return bit, nil
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"sort"
+)
+
+// The block encoding splits the input into blocks that are encoded
+// independently with their own code length tables, so every block adapts to
+// its own content and can be decoded on its own:
+//
+//	header crc   4 bytes  CRC-32 of magic, version and flags
+//	blocks       per block:
+//	  size       8 bytes  length of the encoded block that follows
+//	  block      the static encoding (length, symbols, table, padding,
+//	             header crc, data, data crc), with the header checksum
+//	             covering only the block's own header
+//	end          8 bytes  zero
+//	index        per block:
+//	  offset     8 bytes  position of the block's size field in the file
+//	  length     8 bytes  uncompressed length of the block
+//	count        8 bytes  number of blocks
+//
+// Blocks are read one at a time, so only a single block is ever held in
+// memory and r may be a pipe.
+
+type blockEntry struct {
+	offset uint64
+	length uint64
+}
+
+// compressBlocks encodes r in blocks of blockSize bytes. It returns the
+// number of bytes written and read.
+func compressBlocks(w io.Writer, r io.Reader, blockSize int) (int64, int64, error) {
+
+	if blockSize <= 0 {
+		return 0, 0, fmt.Errorf("invalid block size %d", blockSize)
+	}
+
+	buffered := bufio.NewWriter(w)
+	out := &countingWriter{w: buffered}
+	size := int64(0)
+
+	if _, err := out.Write(appendChecksum(marshalPreamble(flagBlocks))); err != nil {
+		return out.n, size, err
+	}
+
+	index := []blockEntry{}
+	block := make([]byte, blockSize)
+	encoded := new(bytes.Buffer)
+
+	for {
+		n, err := io.ReadFull(r, block)
+		if n == 0 && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return out.n, size, err
+		}
+
+		encoded.Reset()
+		if err := encodeBlock(encoded, block[:n]); err != nil {
+			return out.n, size, err
+		}
+
+		index = append(index, blockEntry{offset: uint64(out.n), length: uint64(n)})
+
+		raw := binary.LittleEndian.AppendUint64(nil, uint64(encoded.Len()))
+		if _, err := out.Write(append(raw, encoded.Bytes()...)); err != nil {
+			return out.n, size, err
+		}
+		size += int64(n)
+	}
+
+	raw := binary.LittleEndian.AppendUint64(nil, 0)
+	for _, entry := range index {
+		raw = binary.LittleEndian.AppendUint64(raw, entry.offset)
+		raw = binary.LittleEndian.AppendUint64(raw, entry.length)
+	}
+	raw = binary.LittleEndian.AppendUint64(raw, uint64(len(index)))
+
+	if _, err := out.Write(raw); err != nil {
+		return out.n, size, err
+	}
+
+	return out.n, size, buffered.Flush()
+}
+
+// encodeBlock writes the static encoding of block.
+func encodeBlock(w io.Writer, block []byte) error {
+
+	freq := frequencies(block)
+	lengths := huffmanCodeLengths(freq, maxCodeLength)
+
+	hdr := header{
+		length:  uint64(len(block)),
+		lengths: lengths,
+		rem:     padding(codeSize(freq, lengths)),
+	}
+
+	if _, err := w.Write(appendChecksum(hdr.marshal())); err != nil {
+		return err
+	}
+
+	if err := encodeStream(w, bytes.NewReader(block), lengths); err != nil {
+		return err
+	}
+
+	_, err := w.Write(binary.LittleEndian.AppendUint32(nil, crc32.ChecksumIEEE(block)))
+	return err
+}
+
+// decodeBlocks decodes all blocks of r in order and checks the index, where
+// h holds the checksum of the header bytes read so far.
+func decodeBlocks(w io.Writer, r io.Reader, h hash.Hash32) error {
+
+	if err := checkHeader(r, h); err != nil {
+		return err
+	}
+
+	index := []blockEntry{}
+	offset := uint64(len(magic) + 2 + 4)
+
+	for {
+		size, err := readUint64(r)
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			break
+		}
+
+		length := &countingWriter{w: w}
+		if err := decodeBlock(length, io.LimitReader(r, int64(size))); err != nil {
+			return fmt.Errorf("block %d: %w", len(index), err)
+		}
+
+		index = append(index, blockEntry{offset: offset, length: uint64(length.n)})
+		offset += 8 + size
+	}
+
+	for i, want := range index {
+		var have blockEntry
+		var err error
+		if have.offset, err = readUint64(r); err != nil {
+			return err
+		}
+		if have.length, err = readUint64(r); err != nil {
+			return err
+		}
+		if have != want {
+			return fmt.Errorf("index entry %d does not match block", i)
+		}
+	}
+
+	count, err := readUint64(r)
+	if err != nil {
+		return err
+	}
+	if count != uint64(len(index)) {
+		return fmt.Errorf("index counts %d blocks, found %d", count, len(index))
+	}
+
+	return nil
+}
+
+// decodeBlock decodes the encoded block r, which must hold nothing else.
+func decodeBlock(w io.Writer, r io.Reader) error {
+
+	in := bufio.NewReader(r)
+
+	if err := decodeStatic(w, in, crc32.NewIEEE()); err != nil {
+		return err
+	}
+
+	return expectEOF(in, "the end of the block")
+}
+
+func readUint64(r io.Reader) (uint64, error) {
+	raw := make([]byte, 8)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return 0, fmt.Errorf("file too short for block structure")
+	}
+	return binary.LittleEndian.Uint64(raw), nil
+}
+
+// blockFile gives random access to a block encoded file.
+type blockFile struct {
+	r      io.ReaderAt
+	blocks []blockEntry
+
+	// starts holds the uncompressed position of every block
+	starts []uint64
+	length uint64
+}
+
+// openBlockFile reads the block index of the file r of the given size.
+func openBlockFile(r io.ReaderAt, size int64) (*blockFile, error) {
+
+	in := io.NewSectionReader(r, 0, size)
+	h := crc32.NewIEEE()
+
+	flags, err := readPreamble(io.TeeReader(in, h))
+	if err != nil {
+		return nil, err
+	}
+	if flags&flagBlocks == 0 {
+		return nil, fmt.Errorf("not a block encoded file")
+	}
+	if err := checkHeader(in, h); err != nil {
+		return nil, err
+	}
+
+	preamble := int64(len(magic) + 2 + 4)
+	if size < preamble+16 {
+		return nil, fmt.Errorf("file too short for block index")
+	}
+
+	count, err := readUint64(io.NewSectionReader(r, size-8, 8))
+	if err != nil {
+		return nil, err
+	}
+	if count > uint64(size-preamble-16)/16 {
+		return nil, fmt.Errorf("invalid block count %d", count)
+	}
+
+	start := size - 8 - 16*int64(count)
+	raw := make([]byte, 16*count)
+	if _, err := r.ReadAt(raw, start); err != nil {
+		return nil, err
+	}
+
+	f := &blockFile{r: r}
+	for i := range int(count) {
+		entry := blockEntry{
+			offset: binary.LittleEndian.Uint64(raw[16*i:]),
+			length: binary.LittleEndian.Uint64(raw[16*i+8:]),
+		}
+		if entry.offset < uint64(preamble) || entry.offset >= uint64(start) {
+			return nil, fmt.Errorf("index entry %d points outside the blocks", i)
+		}
+		f.blocks = append(f.blocks, entry)
+		f.starts = append(f.starts, f.length)
+		f.length += entry.length
+	}
+
+	return f, nil
+}
+
+// readRange writes length bytes of the original data starting at start to
+// w, decoding only the blocks that overlap the range.
+func (f *blockFile) readRange(w io.Writer, start, length uint64) error {
+
+	if start > f.length || length > f.length-start {
+		return fmt.Errorf("range %d+%d exceeds the length %d", start, length, f.length)
+	}
+
+	// first block that ends after start
+	first := sort.Search(len(f.blocks), func(i int) bool {
+		return f.starts[i]+f.blocks[i].length > start
+	})
+
+	for i := first; i < len(f.blocks) && length > 0; i++ {
+
+		block, err := f.block(i)
+		if err != nil {
+			return err
+		}
+
+		lo := start - f.starts[i]
+		hi := min(uint64(len(block)), lo+length)
+
+		if _, err := w.Write(block[lo:hi]); err != nil {
+			return err
+		}
+
+		start += hi - lo
+		length -= hi - lo
+	}
+
+	return nil
+}
+
+// block decodes block i.
+func (f *blockFile) block(i int) ([]byte, error) {
+
+	entry := f.blocks[i]
+
+	size, err := readUint64(io.NewSectionReader(f.r, int64(entry.offset), 8))
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	if err := decodeBlock(buf, io.NewSectionReader(f.r, int64(entry.offset)+8, int64(size))); err != nil {
+		return nil, fmt.Errorf("block %d: %w", i, err)
+	}
+
+	if uint64(buf.Len()) != entry.length {
+		return nil, fmt.Errorf("block %d has length %d, index says %d", i, buf.Len(), entry.length)
+	}
+
+	return buf.Bytes(), nil
+}
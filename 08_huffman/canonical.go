@@ -0,0 +1,167 @@
+package main
+
+import (
+	"slices"
+)
+
+// maxCodeLength bounds the length of any code, like in DEFLATE.
+const maxCodeLength = 15
+
+// huffmanCodeLengths returns the code length of every byte value for the
+// frequencies freq, with no code longer than maxLength bits.
+func huffmanCodeLengths(freq []uint64, maxLength int) []byte {
+
+	root := buildTree(freq)
+	if root == nil || root.depth <= maxLength {
+		return codeLengths(root)
+	}
+
+	return packageMerge(freq, maxLength)
+}
+
+// packageMerge computes optimal length-limited code lengths with the
+// package-merge algorithm: every symbol's code length is the number of
+// selected items it takes part in.
+func packageMerge(freq []uint64, maxLength int) []byte {
+
+	type item struct {
+		weight  uint64
+		symbols []byte
+	}
+
+	leaves := []item{}
+	for symbol, f := range freq {
+		if f != 0 {
+			leaves = append(leaves, item{f, []byte{byte(symbol)}})
+		}
+	}
+	slices.SortStableFunc(leaves, func(a, b item) int {
+		return cmpWeight(a.weight, b.weight)
+	})
+
+	list := leaves
+	for range maxLength - 1 {
+
+		packages := []item{}
+		for i := 0; i+1 < len(list); i += 2 {
+			symbols := append(slices.Clone(list[i].symbols), list[i+1].symbols...)
+			packages = append(packages, item{list[i].weight + list[i+1].weight, symbols})
+		}
+
+		// merge, preferring leaves on equal weight
+		merged := make([]item, 0, len(leaves)+len(packages))
+		i, j := 0, 0
+		for i < len(leaves) || j < len(packages) {
+			if j == len(packages) || (i < len(leaves) && leaves[i].weight <= packages[j].weight) {
+				merged = append(merged, leaves[i])
+				i++
+			} else {
+				merged = append(merged, packages[j])
+				j++
+			}
+		}
+		list = merged
+	}
+
+	lengths := make([]byte, 256)
+	for _, it := range list[:2*len(leaves)-2] {
+		for _, symbol := range it.symbols {
+			lengths[symbol]++
+		}
+	}
+
+	return lengths
+}
+
+func cmpWeight(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// codeLengths returns the depth of every leaf of the tree, indexed by byte
+// value. A tree consisting of a single leaf still needs one bit per symbol.
+func codeLengths(root *node) []byte {
+	lengths := make([]byte, 256)
+	if root != nil {
+		addLengths(lengths, 0, root)
+	}
+	return lengths
+}
+
+func addLengths(lengths []byte, depth int, n *node) {
+
+	if n.isLeaf {
+		lengths[n.element] = byte(max(depth, 1))
+		return
+	}
+
+	addLengths(lengths, depth+1, n.left)
+	addLengths(lengths, depth+1, n.right)
+}
+
+// canonicalCodes assigns consecutive codes to the symbols ordered by code
+// length and then by byte value, so the code lengths alone suffice to
+// reconstruct the codes.
+func canonicalCodes(lengths []byte) map[byte][]bool {
+
+	maxLength := 0
+	for _, l := range lengths {
+		maxLength = max(maxLength, int(l))
+	}
+
+	lut := map[byte][]bool{}
+
+	code := []bool{}
+	for l := 1; l <= maxLength; l++ {
+		code = append(code, false)
+		for symbol, length := range lengths {
+			if int(length) == l {
+				lut[byte(symbol)] = slices.Clone(code)
+				code = increment(code)
+			}
+		}
+	}
+
+	return lut
+}
+
+// increment adds one to the binary number code, most-significant bit first.
+func increment(code []bool) []bool {
+	next := slices.Clone(code)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i] = !next[i]
+		if next[i] {
+			break
+		}
+	}
+	return next
+}
+
+// canonicalTree rebuilds the decoding tree from the code lengths.
+func canonicalTree(lengths []byte) *node {
+
+	root := &node{}
+
+	for symbol, code := range canonicalCodes(lengths) {
+		n := root
+		for _, bit := range code {
+			next := &n.left
+			if bit {
+				next = &n.right
+			}
+			if *next == nil {
+				*next = &node{}
+			}
+			n = *next
+		}
+		n.element = symbol
+		n.isLeaf = true
+	}
+
+	return root
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// Every header is followed by the CRC-32 of all its bytes, starting at the
+// magic number (or, in the block encoding, at the start of the block), and
+// every bitstream is followed by the CRC-32 of the original data.
+
+var (
+	errHeaderChecksum = errors.New("header checksum mismatch")
+	errDataChecksum   = errors.New("data checksum mismatch")
+)
+
+// appendChecksum appends the CRC-32 of raw to raw.
+func appendChecksum(raw []byte) []byte {
+	return binary.LittleEndian.AppendUint32(raw, crc32.ChecksumIEEE(raw))
+}
+
+// writeChecksum writes the CRC-32 accumulated in h.
+func writeChecksum(w io.Writer, h hash.Hash32) error {
+	_, err := w.Write(binary.LittleEndian.AppendUint32(nil, h.Sum32()))
+	return err
+}
+
+// checkHeader reads the stored header checksum and compares it to h.
+func checkHeader(r io.Reader, h hash.Hash32) error {
+	return checkSum(r, h, errHeaderChecksum)
+}
+
+// checkData reads the stored data checksum and compares it to h.
+func checkData(r io.Reader, h hash.Hash32) error {
+	return checkSum(r, h, errDataChecksum)
+}
+
+func checkSum(r io.Reader, h hash.Hash32, mismatch error) error {
+
+	raw := make([]byte, 4)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return fmt.Errorf("file too short for checksum")
+	}
+
+	stored := binary.LittleEndian.Uint32(raw)
+	if computed := h.Sum32(); computed != stored {
+		return fmt.Errorf("%w: stored CRC-32 0x%08X, computed 0x%08X", mismatch, stored, computed)
+	}
+
+	return nil
+}
+
+// expectEOF fails if r holds any more data.
+func expectEOF(r io.Reader, after string) error {
+	if n, _ := io.Copy(io.Discard, r); n != 0 {
+		return fmt.Errorf("unexpected data after %s", after)
+	}
+	return nil
+}
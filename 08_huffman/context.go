@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math/bits"
+)
+
+// The order-1 context mode codes every byte with a table chosen by the byte
+// before it. A context only gets its own table if that saves more bits than
+// the table costs, all other contexts share the fallback table:
+//
+//	length       8 bytes  length of the original data
+//	padding      1 byte   number of unused bits in the last data byte
+//	fallback     code length table
+//	contexts     32 bytes bitmap of the preceding bytes with their own table
+//	tables       one code length table per set bit, in byte order
+//	header crc   4 bytes  CRC-32 of all header bytes from magic on
+//	data         the packed bitstream, least-significant bit first
+//	data crc     4 bytes  CRC-32 of the original data
+//
+// A code length table is a 32 byte bitmap of the coded symbols followed by
+// their code lengths, two per byte. The first byte is coded in context 0.
+
+const initialContext = 0
+
+type contextModel struct {
+	fallback []byte
+	tables   [256][]byte
+}
+
+// lengths returns the code lengths used after the byte prev.
+func (m *contextModel) lengths(prev byte) []byte {
+	if m.tables[prev] != nil {
+		return m.tables[prev]
+	}
+	return m.fallback
+}
+
+// contextFrequencies counts every byte value per preceding byte.
+func contextFrequencies(r io.Reader) ([256][]uint64, int64, error) {
+
+	freq := [256][]uint64{}
+	for i := range freq {
+		freq[i] = make([]uint64, 256)
+	}
+
+	size := int64(0)
+	prev := byte(initialContext)
+
+	in := bufio.NewReader(r)
+	for {
+		b, err := in.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return freq, size, err
+		}
+		freq[prev][b]++
+		prev = b
+		size++
+	}
+
+	return freq, size, nil
+}
+
+// contextRounds bounds how often newContextModel revises its decisions.
+const contextRounds = 16
+
+// newContextModel decides which contexts get their own table. A decision
+// changes the fallback table the dropped contexts share, so the decisions are
+// revised against the resulting fallback until they no longer change.
+func newContextModel(freq [256][]uint64) *contextModel {
+
+	own := [256][]byte{}
+	total := make([]uint64, 256)
+	for prev, f := range freq {
+		own[prev] = huffmanCodeLengths(f, maxCodeLength)
+		for symbol := range f {
+			total[symbol] += f[symbol]
+		}
+	}
+
+	// the first decisions are made against a table for all contexts
+	m := &contextModel{fallback: huffmanCodeLengths(total, maxCodeLength)}
+
+	keep := [256]bool{}
+	for round := range contextRounds {
+
+		next := [256]bool{}
+		for prev, f := range freq {
+			next[prev] = keepTable(f, own[prev], m.fallback)
+		}
+		if round > 0 && next == keep {
+			break
+		}
+		keep = next
+
+		rare := make([]uint64, 256)
+		for prev, f := range freq {
+			m.tables[prev] = nil
+			if keep[prev] {
+				m.tables[prev] = own[prev]
+				continue
+			}
+			for symbol := range f {
+				rare[symbol] += f[symbol]
+			}
+		}
+		m.fallback = huffmanCodeLengths(rare, maxCodeLength)
+	}
+
+	return m
+}
+
+// keepTable reports whether coding f with its own table saves more bits than
+// the table adds to the header, compared to coding it with fallback.
+func keepTable(f []uint64, own, fallback []byte) bool {
+	for symbol, n := range f {
+		if n > 0 && fallback[symbol] == 0 {
+			return true
+		}
+	}
+	saved := int64(codeSize(f, fallback)) - int64(codeSize(f, own))
+	return saved > 8*int64(len(marshalLengths(own)))
+}
+
+func (m *contextModel) marshal() []byte {
+
+	raw := marshalLengths(m.fallback)
+
+	contexts := make([]byte, 32)
+	tables := []byte{}
+	for prev, lengths := range m.tables {
+		if lengths != nil {
+			contexts[prev/8] |= 1 << (prev % 8)
+			tables = append(tables, marshalLengths(lengths)...)
+		}
+	}
+
+	raw = append(raw, contexts...)
+	return append(raw, tables...)
+}
+
+func readContextModel(r io.Reader) (*contextModel, error) {
+
+	m := &contextModel{}
+
+	var err error
+	if m.fallback, err = readLengths(r); err != nil {
+		return nil, err
+	}
+
+	contexts := make([]byte, 32)
+	if _, err := io.ReadFull(r, contexts); err != nil {
+		return nil, fmt.Errorf("file too short for context bitmap")
+	}
+
+	for prev := range m.tables {
+		if contexts[prev/8]&(1<<(prev%8)) != 0 {
+			if m.tables[prev], err = readLengths(r); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// marshalLengths writes the code lengths as a bitmap of the coded symbols
+// followed by their lengths in nibbles, low nibble first.
+func marshalLengths(lengths []byte) []byte {
+
+	bitmap := make([]byte, 32)
+	nibbles := []byte{}
+	for symbol, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		bitmap[symbol/8] |= 1 << (symbol % 8)
+		nibbles = append(nibbles, l)
+	}
+
+	raw := bitmap
+	for i := 0; i < len(nibbles); i += 2 {
+		b := nibbles[i]
+		if i+1 < len(nibbles) {
+			b |= nibbles[i+1] << 4
+		}
+		raw = append(raw, b)
+	}
+
+	return raw
+}
+
+func readLengths(r io.Reader) ([]byte, error) {
+
+	bitmap := make([]byte, 32)
+	if _, err := io.ReadFull(r, bitmap); err != nil {
+		return nil, fmt.Errorf("file too short for code length table")
+	}
+
+	count := 0
+	for _, b := range bitmap {
+		count += bits.OnesCount8(b)
+	}
+
+	nibbles := make([]byte, (count+1)/2)
+	if _, err := io.ReadFull(r, nibbles); err != nil {
+		return nil, fmt.Errorf("file too short for code length table")
+	}
+
+	lengths := make([]byte, 256)
+	i := 0
+	for symbol := range lengths {
+		if bitmap[symbol/8]&(1<<(symbol%8)) == 0 {
+			continue
+		}
+		l := (nibbles[i/2] >> (4 * (i % 2))) & 0x0F
+		if l == 0 {
+			return nil, fmt.Errorf("symbol %d has code length 0", symbol)
+		}
+		lengths[symbol] = l
+		i++
+	}
+
+	return lengths, nil
+}
+
+// compressContext encodes r with the order-1 context mode, reading it twice.
+// It returns the number of bytes written and read.
+func compressContext(w io.Writer, r io.ReadSeeker) (int64, int64, error) {
+
+	freq, size, err := contextFrequencies(r)
+	if err != nil {
+		return 0, size, err
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, size, err
+	}
+
+	m := newContextModel(freq)
+
+	total := uint64(0)
+	for prev, f := range freq {
+		total += codeSize(f, m.lengths(byte(prev)))
+	}
+
+	raw := marshalPreamble(flagContext)
+	raw = binary.LittleEndian.AppendUint64(raw, uint64(size))
+	raw = append(raw, padding(total))
+	raw = append(raw, m.marshal()...)
+
+	out := &countingWriter{w: w}
+	if _, err := out.Write(appendChecksum(raw)); err != nil {
+		return out.n, size, err
+	}
+
+	codes := [256][256]uint64{}
+	lengths := [256][256]uint{}
+	for prev := range codes {
+		codes[prev], lengths[prev] = packCodes(canonicalCodes(m.lengths(byte(prev))))
+	}
+
+	sum := crc32.NewIEEE()
+	in := bufio.NewReader(io.TeeReader(r, sum))
+	bw := newBitWriter(out)
+
+	prev := byte(initialContext)
+	for {
+		b, err := in.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return out.n, size, err
+		}
+		if err := bw.writeBits(codes[prev][b], lengths[prev][b]); err != nil {
+			return out.n, size, err
+		}
+		prev = b
+	}
+
+	if err := bw.flush(); err != nil {
+		return out.n, size, err
+	}
+
+	return out.n, size, writeChecksum(out, sum)
+}
+
+// decodeContext decodes the order-1 context mode and writes it to w, where h
+// holds the checksum of the header bytes read so far.
+func decodeContext(w io.Writer, r *bufio.Reader, h hash.Hash32) error {
+
+	hdr := io.TeeReader(r, h)
+
+	fixed := make([]byte, 8+1)
+	if _, err := io.ReadFull(hdr, fixed); err != nil {
+		return fmt.Errorf("file too short for a header")
+	}
+	length := binary.LittleEndian.Uint64(fixed)
+	rem := fixed[8]
+	if rem > 8 {
+		return fmt.Errorf("invalid padding %d", rem)
+	}
+
+	m, err := readContextModel(hdr)
+	if err != nil {
+		return err
+	}
+
+	if err := checkHeader(r, h); err != nil {
+		return err
+	}
+
+	fallback := canonicalTree(m.fallback)
+	trees := [256]*node{}
+	for prev, lengths := range m.tables {
+		trees[prev] = fallback
+		if lengths != nil {
+			trees[prev] = canonicalTree(lengths)
+		}
+	}
+
+	stream := newBitReader(r, rem)
+	sum := crc32.NewIEEE()
+	out := bufio.NewWriter(io.MultiWriter(w, sum))
+
+	prev := byte(initialContext)
+	for range length {
+		symbol, err := nextElement(trees[prev], stream)
+		if err == io.EOF {
+			return fmt.Errorf("data ends before %d bytes were decoded", length)
+		}
+		if err != nil {
+			return err
+		}
+		if err := out.WriteByte(symbol); err != nil {
+			return err
+		}
+		prev = symbol
+	}
+
+	if err := stream.alignToByte(); err != nil {
+		return err
+	}
+
+	if err := out.Flush(); err != nil {
+		return err
+	}
+
+	return checkData(r, sum)
+}
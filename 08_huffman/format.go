@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"slices"
+)
+
+// On-disk layout of a .huff file (all integers little-endian):
+//
+//	magic        4 bytes  "HUFF"
+//	version      1 byte
+//	flags        1 byte   flagAdaptive, flagBlocks or flagContext
+//
+// followed by the static encoding
+//
+//	length       8 bytes  length of the original data
+//	symbols      2 bytes  number of entries in the code length table
+//	table        symbols * (byte value, code length)
+//	padding      1 byte   number of unused bits in the last data byte
+//	header crc   4 bytes  CRC-32 of all header bytes from magic on
+//	data         the packed bitstream, least-significant bit first
+//	data crc     4 bytes  CRC-32 of the original data
+//
+// or, if flagAdaptive is set, by the adaptive encoding
+//
+//	header crc   4 bytes  CRC-32 of all header bytes from magic on
+//	data         the packed bitstream, terminated by the end of stream symbol
+//	data crc     4 bytes  CRC-32 of the original data
+//
+// or, if flagBlocks is set, by the block encoding described in blocks.go, or,
+// if flagContext is set, by the order-1 encoding described in context.go.
+
+const (
+	huffSuffix    = ".huff"
+	formatVersion = 3
+)
+
+const (
+	flagAdaptive = 0x01
+	flagBlocks   = 0x02
+	flagContext  = 0x04
+)
+
+var magic = []byte("HUFF")
+
+type header struct {
+	length  uint64
+	lengths []byte
+	rem     byte
+}
+
+func compress(w io.Writer, text []byte) (int, error) {
+	n, _, err := compressStream(w, bytes.NewReader(text))
+	return int(n), err
+}
+
+func decompress(raw []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := decompressStream(buf, bytes.NewReader(raw)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// compressStream reads r twice: once to count the byte frequencies and once
+// to encode it, so the memory use does not depend on the size of r. It
+// returns the number of bytes written and read.
+func compressStream(w io.Writer, r io.ReadSeeker) (int64, int64, error) {
+
+	freq := make([]uint64, 256)
+	size := int64(0)
+
+	in := bufio.NewReader(r)
+	for {
+		b, err := in.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, size, err
+		}
+		freq[b]++
+		size++
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, size, err
+	}
+
+	lengths := huffmanCodeLengths(freq, maxCodeLength)
+
+	hdr := header{
+		length:  uint64(size),
+		lengths: lengths,
+		rem:     padding(codeSize(freq, lengths)),
+	}
+
+	out := &countingWriter{w: w}
+
+	if _, err := out.Write(appendChecksum(append(marshalPreamble(0), hdr.marshal()...))); err != nil {
+		return out.n, size, err
+	}
+
+	sum := crc32.NewIEEE()
+	if err := encodeStream(out, io.TeeReader(r, sum), lengths); err != nil {
+		return out.n, size, err
+	}
+
+	return out.n, size, writeChecksum(out, sum)
+}
+
+// compressAdaptive encodes r in a single pass, so r may be a pipe. It
+// returns the number of bytes written and read.
+func compressAdaptive(w io.Writer, r io.Reader) (int64, int64, error) {
+
+	out := &countingWriter{w: w}
+
+	if _, err := out.Write(appendChecksum(marshalPreamble(flagAdaptive))); err != nil {
+		return out.n, 0, err
+	}
+
+	sum := crc32.NewIEEE()
+	size, err := encodeAdaptive(out, io.TeeReader(r, sum))
+	if err != nil {
+		return out.n, size, err
+	}
+
+	return out.n, size, writeChecksum(out, sum)
+}
+
+// decompressStream decodes the .huff stream r in any of its modes and
+// writes the original data to w.
+func decompressStream(w io.Writer, r io.Reader) error {
+
+	in := bufio.NewReader(r)
+
+	// the header checksum covers all header bytes from the magic number on
+	h := crc32.NewIEEE()
+
+	flags, err := readPreamble(io.TeeReader(in, h))
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case flags&flagAdaptive != 0:
+		err = decodeAdaptive(w, in, h)
+	case flags&flagBlocks != 0:
+		err = decodeBlocks(w, in, h)
+	case flags&flagContext != 0:
+		err = decodeContext(w, in, h)
+	default:
+		err = decodeStatic(w, in, h)
+	}
+	if err != nil {
+		return err
+	}
+
+	return expectEOF(in, "the end of the data")
+}
+
+// decodeStatic decodes the header and data of the static encoding, where h
+// holds the checksum of the header bytes read so far.
+func decodeStatic(w io.Writer, r *bufio.Reader, h hash.Hash32) error {
+
+	hdr, err := readHeader(io.TeeReader(r, h))
+	if err != nil {
+		return err
+	}
+
+	if err := checkHeader(r, h); err != nil {
+		return err
+	}
+
+	sum := crc32.NewIEEE()
+
+	err = decodeStream(io.MultiWriter(w, sum), r, hdr.lengths, hdr.rem, hdr.length)
+	if err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("data ends before %d bytes were decoded", hdr.length)
+	}
+	if err != nil {
+		return err
+	}
+
+	return checkData(r, sum)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func marshalPreamble(flags byte) []byte {
+	return append(slices.Clone(magic), formatVersion, flags)
+}
+
+// readPreamble checks magic and version and returns the flags.
+func readPreamble(r io.Reader) (byte, error) {
+
+	raw := make([]byte, len(magic)+2)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return 0, fmt.Errorf("file too short for a header")
+	}
+
+	if !slices.Equal(raw[:len(magic)], magic) {
+		return 0, fmt.Errorf("not a huff file")
+	}
+
+	if version := raw[len(magic)]; version != formatVersion {
+		return 0, fmt.Errorf("unsupported version %d", version)
+	}
+
+	switch flags := raw[len(magic)+1]; flags {
+	case 0, flagAdaptive, flagBlocks, flagContext:
+		return flags, nil
+	default:
+		return 0, fmt.Errorf("unknown flags 0x%02X", flags)
+	}
+}
+
+// marshal returns the header of the static encoding.
+func (h header) marshal() []byte {
+
+	raw := []byte{}
+	raw = binary.LittleEndian.AppendUint64(raw, h.length)
+
+	table := []byte{}
+	for symbol, length := range h.lengths {
+		if length != 0 {
+			table = append(table, byte(symbol), length)
+		}
+	}
+	raw = binary.LittleEndian.AppendUint16(raw, uint16(len(table)/2))
+	raw = append(raw, table...)
+
+	return append(raw, h.rem)
+}
+
+// readHeader parses the header of the static encoding and leaves r at the
+// start of the data.
+func readHeader(r io.Reader) (header, error) {
+
+	hdr := header{lengths: make([]byte, 256)}
+
+	fixed := make([]byte, 8+2)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return hdr, fmt.Errorf("file too short for a header")
+	}
+
+	hdr.length = binary.LittleEndian.Uint64(fixed)
+	fixed = fixed[8:]
+
+	symbols := int(binary.LittleEndian.Uint16(fixed))
+
+	table := make([]byte, 2*symbols+1)
+	if _, err := io.ReadFull(r, table); err != nil {
+		return hdr, fmt.Errorf("file too short for code length table")
+	}
+
+	for i := range symbols {
+		if table[2*i+1] > maxCodeLength {
+			return hdr, fmt.Errorf("code length %d of symbol %d exceeds %d", table[2*i+1], table[2*i], maxCodeLength)
+		}
+		hdr.lengths[table[2*i]] = table[2*i+1]
+	}
+
+	hdr.rem = table[2*symbols]
+	if hdr.rem > 8 {
+		return hdr, fmt.Errorf("invalid padding %d", hdr.rem)
+	}
+
+	return hdr, nil
+}
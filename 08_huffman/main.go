@@ -1,188 +1,340 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"flag"
 	"fmt"
+	"io"
 	"os"
-	"slices"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
-type node struct {
-	weight      uint64
-	element     byte
-	isLeaf      bool
-	depth       int
-	left, right *node
-}
+// encode returns the Huffman encoded text, the code length of every byte
+// value and the number of padding bits in the last byte.
+func encode(text []byte) ([]byte, []byte, byte) {
+
+	freq := frequencies(text)
+	lengths := huffmanCodeLengths(freq, maxCodeLength)
+
+	buf := new(bytes.Buffer)
+	mustSucceed(encodeStream(buf, bytes.NewReader(text), lengths))
 
-func sortNodes(m, n *node) int {
-	return int(m.weight - n.weight)
+	return buf.Bytes(), lengths, padding(codeSize(freq, lengths))
 }
 
-func encode(text []byte) ([]byte, *node, byte) {
+// encodeStream writes the Huffman encoding of r to w.
+func encodeStream(w io.Writer, r io.Reader, lengths []byte) error {
 
-	// count # of occurences
-	freq := make([]uint64, 256)
-	for _, b := range text {
-		freq[b]++
+	codes, sizes := packCodes(canonicalCodes(lengths))
+
+	in := bufio.NewReader(r)
+	out := newBitWriter(w)
+
+	for {
+		b, err := in.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := out.writeBits(codes[b], sizes[b]); err != nil {
+			return err
+		}
 	}
 
-	nodes := []*node{}
+	return out.flush()
+}
 
-	for i, f := range freq {
-		if f != 0 {
-			n := node{
-				weight:  f,
-				element: byte(i),
-				isLeaf:  true,
-				depth:   0,
-				left:    nil,
-				right:   nil,
-			}
-			nodes = append(nodes, &n)
+// codeSize returns the number of bits needed to encode the frequencies freq.
+func codeSize(freq []uint64, lengths []byte) uint64 {
+	bits := uint64(0)
+	for symbol, f := range freq {
+		bits += f * uint64(lengths[symbol])
+	}
+	return bits
+}
+
+// decode returns all symbols of the Huffman encoded code.
+func decode(code []byte, lengths []byte, rem byte) []byte {
+
+	stream := newBitReader(bytes.NewReader(code), rem)
+
+	root := canonicalTree(lengths)
+
+	text := []byte{}
+	for {
+		eof, err := stream.eof()
+		mustSucceed(err)
+		if eof {
+			break
 		}
+		symbol, err := nextElement(root, stream)
+		mustSucceed(err)
+		text = append(text, symbol)
 	}
+	return text
+}
+
+// decodeStream decodes n symbols from r and writes them to w. It stops at
+// the end of the byte holding the last code, so r is positioned at whatever
+// follows the bitstream.
+func decodeStream(w io.Writer, r *bufio.Reader, lengths []byte, rem byte, n uint64) error {
+
+	stream := newBitReader(r, rem)
 
-	// create Huffman tree
-	for len(nodes) > 1 {
-		slices.SortFunc(nodes, sortNodes)
+	root := canonicalTree(lengths)
 
-		left, right := nodes[0], nodes[1]
+	out := bufio.NewWriter(w)
 
-		next := &node{
-			weight:  left.weight + right.weight,
-			element: 0,
-			isLeaf:  false,
-			depth:   max(left.depth, right.depth) + 1,
-			left:    left,
-			right:   right,
+	for range n {
+		symbol, err := nextElement(root, stream)
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
 		}
-		nodes = append(nodes[2:], next)
-	}
-
-	// create look-up table
-	lut := map[byte][]bool{}
-	add(lut, []bool{}, nodes[0])
-
-	// replace bytes with Huffman encoding
-	data := []byte{}
-
-	buf := []bool{}
-	for _, b := range text {
-		buf = append(buf, lut[b]...)
-		for len(buf) > 8 {
-			next := byte(0)
-			for i, bit := range buf[0:8] {
-				if bit {
-					next |= (1 << i)
-				}
-			}
-			data = append(data, next)
-			buf = buf[8:]
+		if err != nil {
+			return err
 		}
+		if err := out.WriteByte(symbol); err != nil {
+			return err
+		}
+	}
+
+	if err := stream.alignToByte(); err != nil {
+		return err
 	}
 
-	last := byte(0)
-	for i, bit := range buf {
+	return out.Flush()
+}
+
+func nextElement(n *node, stream *bitReader) (byte, error) {
+
+	for !n.isLeaf {
+
+		bit, err := stream.readBit()
+		if err != nil {
+			return 0, err
+		}
+
 		if bit {
-			last |= (1 << i)
+			n = n.right
+		} else {
+			n = n.left
 		}
-	}
-	data = append(data, last)
 
-	rem := byte(8 - len(buf))
+		if n == nil {
+			return 0, fmt.Errorf("invalid code")
+		}
+	}
 
-	return data, nodes[0], rem
+	return n.element, nil
 }
 
-func add(lut map[byte][]bool, prefix []bool, n *node) {
+func main() {
 
-	if n.isLeaf {
-		code := make([]bool, len(prefix))
-		copy(code, prefix)
-		lut[n.element] = code
+	adaptive := flag.Bool("adaptive", false, "compress in a single pass with adaptive Huffman codes")
+	block := flag.Int("block", 0, "compress in independent blocks of `size` bytes with a block index")
+	context := flag.Bool("context", false, "compress with one code table per preceding byte (order-1)")
+	stats := flag.Bool("stats", false, "print code statistics of the input instead of compressing it")
+	asJSON := flag.Bool("json", false, "print the statistics as JSON")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: huff [-adaptive | -block size | -context] [compress|decompress [<path>]]")
+		fmt.Fprintln(os.Stderr, "       huff range <path> <start> <length>")
+		fmt.Fprintln(os.Stderr, "       huff -stats [-json] [<path>]")
+		fmt.Fprintln(os.Stderr, "without a path, huff reads stdin and writes stdout")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *stats {
+		exitOnError(printStats(os.Stdout, flag.Arg(0), *asJSON))
 		return
 	}
 
-	add(lut, append(prefix, false), n.left)
-	add(lut, append(prefix, true), n.right)
+	command := "compress"
+	if flag.NArg() > 0 {
+		command = flag.Arg(0)
+	}
+
+	path := ""
+	if flag.NArg() > 1 {
+		path = flag.Arg(1)
+	}
+
+	modes := 0
+	compress := compressStream
+	if *adaptive {
+		modes++
+		compress = func(w io.Writer, r io.ReadSeeker) (int64, int64, error) {
+			return compressAdaptive(w, r)
+		}
+	}
+	if *block != 0 {
+		modes++
+		compress = func(w io.Writer, r io.ReadSeeker) (int64, int64, error) {
+			return compressBlocks(w, r, *block)
+		}
+	}
+	if *context {
+		modes++
+		compress = compressContext
+	}
+	if modes > 1 {
+		fmt.Fprintln(os.Stderr, "-adaptive, -block and -context cannot be combined")
+		os.Exit(1)
+	}
+
+	switch {
+	case command == "compress" && path != "":
+		exitOnError(compressFile(path, compress))
+	case command == "compress" && *block != 0:
+		_, _, err := compressBlocks(os.Stdout, os.Stdin, *block)
+		exitOnError(err)
+	case command == "compress" && *adaptive:
+		_, _, err := compressAdaptive(os.Stdout, os.Stdin)
+		exitOnError(err)
+	case command == "compress":
+		fmt.Fprintln(os.Stderr, "compressing stdin needs -adaptive or -block, the other modes need two passes over a file")
+		os.Exit(1)
+	case command == "decompress" && path != "":
+		exitOnError(decompressFile(path))
+	case command == "decompress":
+		exitOnError(decompressStream(os.Stdout, os.Stdin))
+	case command == "range" && flag.NArg() == 4:
+		start, err := strconv.ParseUint(flag.Arg(2), 10, 64)
+		exitOnError(err)
+		length, err := strconv.ParseUint(flag.Arg(3), 10, 64)
+		exitOnError(err)
+		exitOnError(readRangeFile(os.Stdout, path, start, length))
+	default:
+		flag.Usage()
+		os.Exit(1)
+	}
 }
 
-type bitReader struct {
-	code []byte
-	buf  []bool
-	rem  byte
+func mustSucceed(err error) {
+	if err != nil {
+		panic(err)
+	}
 }
 
-func (r *bitReader) eof() bool {
-	return len(r.code) == 0 && len(r.buf) == int(r.rem)
+// exitOnError reports err and exits, for errors caused by the input rather
+// than by a bug.
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "huff: %v\n", err)
+		os.Exit(1)
+	}
 }
 
-func (r *bitReader) pop() bool {
+func compressFile(path string, compress func(io.Writer, io.ReadSeeker) (int64, int64, error)) error {
 
-	if r.eof() {
-		panic("eof")
+	in, err := os.Open(path)
+	if err != nil {
+		return err
 	}
+	defer in.Close()
 
-	if len(r.buf) == 0 {
-		bits := r.code[0]
-		r.code = r.code[1:]
+	out, err := os.Create(path + huffSuffix)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
 
-		r.buf = make([]bool, 8)
-		for i := range r.buf {
-			r.buf[i] = (bits & (1 << i)) > 0
-		}
+	n, size, err := compress(out, in)
+	if err != nil {
+		return err
 	}
 
-	bit := r.buf[0]
-	r.buf = r.buf[1:]
-	return bit
+	if size == 0 {
+		fmt.Printf("compressed empty input to %d bytes\n", n)
+	} else {
+		fmt.Printf("compression rate: %0.2f%%\n", float64(n)/float64(size)*100)
+	}
+
+	return out.Close()
 }
 
-func decode(code []byte, root *node, rem byte) []byte {
-	stream := &bitReader{
-		code: code,
-		rem:  rem,
+func decompressFile(path string) error {
+
+	in, err := os.Open(path)
+	if err != nil {
+		return err
 	}
+	defer in.Close()
 
-	text := []byte{}
-	for !stream.eof() {
-		symbol := nextElement(root, stream)
-		text = append(text, symbol)
+	outpath, ok := strings.CutSuffix(path, huffSuffix)
+	if !ok {
+		outpath = path + ".out"
 	}
-	return text
-}
 
-func nextElement(n *node, stream *bitReader) byte {
-	if n.isLeaf {
-		return n.element
+	// decode next to the output and only replace it once the checksums
+	// passed, so corrupt input never destroys an existing file
+	out, err := os.CreateTemp(filepath.Dir(outpath), "."+filepath.Base(outpath)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	if err := decompressStream(out, in); err != nil {
+		return err
 	}
 
-	bit := stream.pop()
+	if err := out.Chmod(0644); err != nil {
+		return err
+	}
 
-	if bit {
-		return nextElement(n.right, stream)
+	if err := out.Close(); err != nil {
+		return err
 	}
 
-	return nextElement(n.left, stream)
+	return os.Rename(out.Name(), outpath)
 }
 
-func main() {
+func readRangeFile(w io.Writer, path string, start, length uint64) error {
+
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
 
-	path := os.Args[1]
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
 
-	text, err := os.ReadFile(path)
+	f, err := openBlockFile(in, info.Size())
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	code, root, rem := encode(text)
+	return f.readRange(w, start, length)
+}
 
-	reconstruct := decode(code, root, rem)
+func printStats(w io.Writer, path string, asJSON bool) error {
 
-	if err := os.WriteFile(path+".huff", []byte(reconstruct), 0644); err != nil {
-		panic(err)
+	in := os.Stdin
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
 	}
 
-	fmt.Printf("compression rate: %0.2f%%\n", float64(len(code))/float64(len(text))*100)
+	s, err := collectStats(in)
+	if err != nil {
+		return err
+	}
 
+	if asJSON {
+		return s.writeJSON(w)
+	}
+	return s.writeText(w)
 }
@@ -1,9 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"reflect"
+	"slices"
 	"testing"
+	"testing/iotest"
 )
 
 func Test_EncodeDecode(t *testing.T) {
@@ -15,8 +23,8 @@ func Test_EncodeDecode(t *testing.T) {
 	for i, tt := range tests {
 		t.Run(fmt.Sprint(i), func(t *testing.T) {
 			given := []byte(tt.text)
-			code, root, rem := encode(given)
-			have := decode(code, root, rem)
+			code, lengths, rem := encode(given)
+			have := decode(code, lengths, rem)
 			want := given
 			if !reflect.DeepEqual(have, want) {
 				t.Errorf("compress() = %v, want %v", have, want)
@@ -24,3 +32,533 @@ func Test_EncodeDecode(t *testing.T) {
 		})
 	}
 }
+
+func Test_CompressDecompress(t *testing.T) {
+	tests := []struct {
+		name string
+		text []byte
+	}{
+		{"empty", []byte{}},
+		{"single symbol", []byte("aaaaaaaa")},
+		{"hello", []byte("hello hello world")},
+		{"all bytes", func() []byte {
+			text := []byte{}
+			for i := range 256 {
+				text = append(text, bytes.Repeat([]byte{byte(i)}, i+1)...)
+			}
+			return text
+		}()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			if _, err := compress(buf, tt.text); err != nil {
+				t.Fatal(err)
+			}
+			have, err := decompress(buf.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(have, tt.text) {
+				t.Errorf("decompress() = %v, want %v", have, tt.text)
+			}
+		})
+	}
+}
+
+func Test_CompressFile(t *testing.T) {
+	text, err := os.ReadFile("file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := compress(buf, text); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.Len() >= len(text) {
+		t.Errorf("compressed size %d not smaller than %d", buf.Len(), len(text))
+	}
+
+	have, err := decompress(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(have, text) {
+		t.Error("decompressed data differs from file.txt")
+	}
+}
+
+func Test_DecompressInvalid(t *testing.T) {
+	for _, raw := range [][]byte{
+		{},
+		[]byte("HUFX\x01"),
+		[]byte("HUFF\x09\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"),
+	} {
+		if _, err := decompress(raw); err == nil {
+			t.Errorf("decompress(%q) succeeded", raw)
+		}
+	}
+}
+
+func Test_DecompressFileCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "p.txt")
+
+	buf := new(bytes.Buffer)
+	if _, err := compress(buf, []byte("original")); err != nil {
+		t.Fatal(err)
+	}
+	raw := buf.Bytes()
+	raw[len(raw)-5] ^= 0x01
+
+	if err := os.WriteFile(path+huffSuffix, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("edited"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := decompressFile(path + huffSuffix); err == nil {
+		t.Fatal("corrupt file decompressed")
+	}
+
+	// the existing file is left alone and no temporary file remains
+	if have, err := os.ReadFile(path); err != nil || string(have) != "edited" {
+		t.Errorf("have %q, %v", have, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("have %d files, want 2", len(entries))
+	}
+}
+
+func Test_CodeLengthLimit(t *testing.T) {
+
+	// Fibonacci frequencies produce the deepest possible Huffman tree
+	freq := make([]uint64, 256)
+	a, b := uint64(1), uint64(1)
+	for i := range 30 {
+		freq[i] = a
+		a, b = b, a+b
+	}
+
+	if depth := buildTree(freq).depth; depth <= maxCodeLength {
+		t.Fatalf("tree depth %d does not exceed %d", depth, maxCodeLength)
+	}
+
+	lengths := huffmanCodeLengths(freq, maxCodeLength)
+
+	kraft := 0.0
+	for symbol, l := range lengths {
+		if (freq[symbol] == 0) != (l == 0) {
+			t.Errorf("symbol %d with frequency %d has code length %d", symbol, freq[symbol], l)
+		}
+		if l > maxCodeLength {
+			t.Errorf("symbol %d has code length %d > %d", symbol, l, maxCodeLength)
+		}
+		if l > 0 {
+			kraft += 1 / float64(uint64(1)<<l)
+		}
+	}
+	if kraft > 1 {
+		t.Errorf("code lengths violate Kraft inequality: %f > 1", kraft)
+	}
+
+	text := []byte{}
+	for symbol, f := range freq[:20] {
+		text = append(text, bytes.Repeat([]byte{byte(symbol)}, int(f))...)
+	}
+	code, lengths, rem := encode(text)
+	if have := decode(code, lengths, rem); !bytes.Equal(have, text) {
+		t.Errorf("decode(encode()) does not reproduce the input")
+	}
+}
+
+func Test_Deterministic(t *testing.T) {
+
+	freq := make([]uint64, 256)
+	for _, symbol := range []byte("abcdefgh") {
+		freq[symbol] = 5
+	}
+	for symbol, l := range huffmanCodeLengths(freq, maxCodeLength) {
+		if freq[symbol] != 0 && l != 3 {
+			t.Errorf("symbol %q has code length %d, want 3", symbol, l)
+		}
+	}
+
+	text := []byte("the quick brown fox jumps over the lazy dog")
+	first, _, _ := encode(text)
+	for range 10 {
+		if again, _, _ := encode(text); !bytes.Equal(first, again) {
+			t.Fatalf("encode() is not deterministic")
+		}
+	}
+}
+
+func Test_BitWriterReader(t *testing.T) {
+	buf := new(bytes.Buffer)
+	bw := newBitWriter(buf)
+	want := []bool{}
+	for i := range 100 {
+		n := uint(i%15 + 1)
+		bits := uint64(i * 7919)
+		if err := bw.writeBits(bits, n); err != nil {
+			t.Fatal(err)
+		}
+		for j := range n {
+			want = append(want, bits&(1<<j) != 0)
+		}
+	}
+	if err := bw.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	br := newBitReader(buf, padding(uint64(len(want))))
+	for i, w := range want {
+		have, err := br.readBit()
+		if err != nil {
+			t.Fatalf("bit %d: %v", i, err)
+		}
+		if have != w {
+			t.Fatalf("bit %d = %v, want %v", i, have, w)
+		}
+	}
+	if _, err := br.readBit(); err != io.EOF {
+		t.Errorf("readBit() after last bit = %v, want io.EOF", err)
+	}
+}
+
+func Test_Stream(t *testing.T) {
+	text, err := os.ReadFile("file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compressed := new(bytes.Buffer)
+	n, size, err := compressStream(compressed, bytes.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(compressed.Len()) || size != int64(len(text)) {
+		t.Errorf("compressStream() = %d, %d, want %d, %d", n, size, compressed.Len(), len(text))
+	}
+
+	have := new(bytes.Buffer)
+	if err := decompressStream(have, iotest.OneByteReader(bytes.NewReader(compressed.Bytes()))); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(have.Bytes(), text) {
+		t.Error("decompressed data differs from file.txt")
+	}
+
+	truncated := compressed.Bytes()[:compressed.Len()-10]
+	if err := decompressStream(io.Discard, bytes.NewReader(truncated)); err == nil {
+		t.Error("decompressStream() of truncated data succeeded")
+	}
+}
+
+func Test_Adaptive(t *testing.T) {
+	file, err := os.ReadFile("file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := []byte{}
+	for i := range 256 {
+		all = append(all, bytes.Repeat([]byte{byte(i)}, i+1)...)
+	}
+
+	tests := []struct {
+		name string
+		text []byte
+	}{
+		{"empty", []byte{}},
+		{"single symbol", []byte("aaaaaaaa")},
+		{"hello", []byte("hello hello world")},
+		{"all bytes", all},
+		{"file.txt", file},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			n, size, err := compressAdaptive(buf, iotest.OneByteReader(bytes.NewReader(tt.text)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(buf.Len()) || size != int64(len(tt.text)) {
+				t.Errorf("compressAdaptive() = %d, %d, want %d, %d", n, size, buf.Len(), len(tt.text))
+			}
+			if len(tt.text) > 1000 && buf.Len() >= len(tt.text) {
+				t.Errorf("compressed size %d not smaller than %d", buf.Len(), len(tt.text))
+			}
+			have := new(bytes.Buffer)
+			if err := decompressStream(have, bytes.NewReader(buf.Bytes())); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(have.Bytes(), tt.text) {
+				t.Error("decompressed data differs from input")
+			}
+			if len(tt.text) > 0 {
+				truncated := buf.Bytes()[:buf.Len()-1]
+				if err := decompressStream(io.Discard, bytes.NewReader(truncated)); err == nil {
+					t.Error("decompressStream() of truncated data succeeded")
+				}
+			}
+		})
+	}
+}
+
+func Test_Blocks(t *testing.T) {
+
+	// two halves with disjoint alphabets benefit from separate tables
+	text := append(bytes.Repeat([]byte("abcd"), 4096), bytes.Repeat([]byte("wxyz"), 4096)...)
+
+	for _, blockSize := range []int{1, 1000, 16384, 1 << 20} {
+		t.Run(fmt.Sprint(blockSize), func(t *testing.T) {
+
+			buf := new(bytes.Buffer)
+			n, size, err := compressBlocks(buf, bytes.NewReader(text), blockSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(buf.Len()) || size != int64(len(text)) {
+				t.Errorf("compressBlocks() = %d, %d, want %d, %d", n, size, buf.Len(), len(text))
+			}
+
+			have := new(bytes.Buffer)
+			if err := decompressStream(have, bytes.NewReader(buf.Bytes())); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(have.Bytes(), text) {
+				t.Fatal("decompressed data differs from input")
+			}
+
+			f, err := openBlockFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range [][2]uint64{{0, 0}, {0, 10}, {999, 2}, {16000, 1000}, {0, uint64(len(text))}, {uint64(len(text)), 0}} {
+				have := new(bytes.Buffer)
+				if err := f.readRange(have, r[0], r[1]); err != nil {
+					t.Fatal(err)
+				}
+				if want := text[r[0] : r[0]+r[1]]; !bytes.Equal(have.Bytes(), want) {
+					t.Errorf("readRange(%d, %d) = %q, want %q", r[0], r[1], have.Bytes(), want)
+				}
+			}
+			if err := f.readRange(io.Discard, uint64(len(text)), 1); err == nil {
+				t.Error("readRange() beyond the end succeeded")
+			}
+		})
+	}
+
+	global := new(bytes.Buffer)
+	if _, err := compress(global, text); err != nil {
+		t.Fatal(err)
+	}
+	blocks := new(bytes.Buffer)
+	if _, _, err := compressBlocks(blocks, bytes.NewReader(text), 16384); err != nil {
+		t.Fatal(err)
+	}
+	if blocks.Len() >= global.Len() {
+		t.Errorf("block size %d not smaller than global size %d", blocks.Len(), global.Len())
+	}
+
+	empty := new(bytes.Buffer)
+	if _, _, err := compressBlocks(empty, bytes.NewReader(nil), 16); err != nil {
+		t.Fatal(err)
+	}
+	if have, err := decompress(empty.Bytes()); err != nil || len(have) != 0 {
+		t.Errorf("decompress() of empty block file = %v, %v", have, err)
+	}
+
+	corrupt := slices.Clone(blocks.Bytes())
+	corrupt[len(corrupt)-20]++
+	if _, err := decompress(corrupt); err == nil {
+		t.Error("decompress() with corrupt index succeeded")
+	}
+}
+
+func Test_Stats(t *testing.T) {
+	text := []byte("hello hello world")
+
+	s, err := collectStats(bytes.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compressed := new(bytes.Buffer)
+	if _, err := compress(compressed, text); err != nil {
+		t.Fatal(err)
+	}
+
+	if have := s.HeaderBytes + s.DataBytes; have != uint64(compressed.Len()) {
+		t.Errorf("stats size %d, compressed size %d", have, compressed.Len())
+	}
+	if s.Length != uint64(len(text)) || len(s.Symbols) != 8 {
+		t.Errorf("stats length %d with %d symbols, want %d with 8", s.Length, len(s.Symbols), len(text))
+	}
+	if s.Entropy > s.BitsPerSymbol || s.BitsPerSymbol >= s.Entropy+1 {
+		t.Errorf("bits per symbol %f not within [entropy, entropy+1) = [%f, %f)", s.BitsPerSymbol, s.Entropy, s.Entropy+1)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := s.writeJSON(buf); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Stats
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&decoded, s) {
+		t.Errorf("JSON round trip = %+v, want %+v", decoded, *s)
+	}
+
+	if s, err := collectStats(bytes.NewReader(nil)); err != nil || s.Length != 0 || s.BitsPerSymbol != 0 {
+		t.Errorf("collectStats() of empty input = %+v, %v", s, err)
+	}
+}
+
+func Test_Context(t *testing.T) {
+	all := []byte{}
+	for i := range 256 {
+		all = append(all, bytes.Repeat([]byte{byte(i)}, i+1)...)
+	}
+
+	tests := []struct {
+		name string
+		text []byte
+	}{
+		{"empty", []byte{}},
+		{"single symbol", []byte("aaaaaaaa")},
+		{"hello", []byte("hello hello world")},
+		{"all bytes", all},
+		{"alternating", bytes.Repeat([]byte("ab"), 5000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			n, size, err := compressContext(buf, bytes.NewReader(tt.text))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(buf.Len()) || size != int64(len(tt.text)) {
+				t.Errorf("compressContext() = %d, %d, want %d, %d", n, size, buf.Len(), len(tt.text))
+			}
+			have, err := decompress(buf.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(have, tt.text) {
+				t.Error("decompressed data differs from input")
+			}
+		})
+	}
+}
+
+func Test_ContextGain(t *testing.T) {
+	text, err := os.ReadFile("file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order0 := new(bytes.Buffer)
+	if _, err := compress(order0, text); err != nil {
+		t.Fatal(err)
+	}
+
+	order1 := new(bytes.Buffer)
+	if _, _, err := compressContext(order1, bytes.NewReader(text)); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Logf("file.txt: %d bytes, order-0 %d bytes (%.2f%%), order-1 %d bytes (%.2f%%), gain %.2f%%",
+		len(text),
+		order0.Len(), float64(order0.Len())/float64(len(text))*100,
+		order1.Len(), float64(order1.Len())/float64(len(text))*100,
+		(1-float64(order1.Len())/float64(order0.Len()))*100)
+
+	if order1.Len() >= order0.Len() {
+		t.Errorf("order-1 size %d not smaller than order-0 size %d", order1.Len(), order0.Len())
+	}
+
+	have, err := decompress(order1.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(have, text) {
+		t.Error("decompressed data differs from file.txt")
+	}
+}
+
+func Test_ContextModel(t *testing.T) {
+	text, err := os.ReadFile("file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	freq, _, err := contextFrequencies(bytes.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every decision must hold against the fallback that is actually used
+	m := newContextModel(freq)
+	for prev, f := range freq {
+		own := huffmanCodeLengths(f, maxCodeLength)
+		if kept := m.tables[prev] != nil; kept != keepTable(f, own, m.fallback) {
+			t.Errorf("context %d: table kept %v, but saves %d bits for a %d byte table", prev, kept,
+				int64(codeSize(f, m.fallback))-int64(codeSize(f, own)), len(marshalLengths(own)))
+		}
+	}
+}
+
+func Test_Corruption(t *testing.T) {
+	text := []byte("hello hello world, hello checksum")
+
+	modes := map[string]func(io.Writer, io.ReadSeeker) (int64, int64, error){
+		"static": compressStream,
+		"adaptive": func(w io.Writer, r io.ReadSeeker) (int64, int64, error) {
+			return compressAdaptive(w, r)
+		},
+		"blocks": func(w io.Writer, r io.ReadSeeker) (int64, int64, error) {
+			return compressBlocks(w, r, 16)
+		},
+		"context": compressContext,
+	}
+
+	for name, compress := range modes {
+		t.Run(name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			if _, _, err := compress(buf, bytes.NewReader(text)); err != nil {
+				t.Fatal(err)
+			}
+			raw := buf.Bytes()
+
+			// every single bit flip must be detected
+			for i := range 8 * len(raw) {
+				corrupt := slices.Clone(raw)
+				corrupt[i/8] ^= 1 << (i % 8)
+				if have, err := decompress(corrupt); err == nil {
+					t.Fatalf("flipping bit %d went unnoticed, decompressed %q", i, have)
+				}
+			}
+
+			if name == "blocks" {
+				return
+			}
+
+			corrupt := slices.Clone(raw)
+			corrupt[len(magic)+2] ^= 0x01
+			if _, err := decompress(corrupt); !errors.Is(err, errHeaderChecksum) {
+				t.Errorf("corrupt header: %v, want %v", err, errHeaderChecksum)
+			}
+
+			corrupt = slices.Clone(raw)
+			corrupt[len(corrupt)-1] ^= 0x80
+			if _, err := decompress(corrupt); !errors.Is(err, errDataChecksum) {
+				t.Errorf("corrupt data checksum: %v, want %v", err, errDataChecksum)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// SymbolStats describes the static code of a single byte value.
+type SymbolStats struct {
+	Symbol     byte   `json:"symbol"`
+	Frequency  uint64 `json:"frequency"`
+	CodeLength int    `json:"code_length"`
+	Code       string `json:"code"`
+	Bits       uint64 `json:"bits"`
+}
+
+// Stats summarizes how well the static Huffman code fits the input.
+type Stats struct {
+	Length        uint64        `json:"length"`
+	Symbols       []SymbolStats `json:"symbols"`
+	Entropy       float64       `json:"entropy"`
+	BitsPerSymbol float64       `json:"bits_per_symbol"`
+	Efficiency    float64       `json:"efficiency"`
+	TreeDepth     int           `json:"tree_depth"`
+	MaxCodeLength int           `json:"max_code_length"`
+	DataBytes     uint64        `json:"data_bytes"`
+	HeaderBytes   uint64        `json:"header_bytes"` // checksums included
+	Ratio         float64       `json:"ratio"`
+}
+
+// collectStats reads r once and computes the statistics of its static code.
+func collectStats(r io.Reader) (*Stats, error) {
+
+	freq := make([]uint64, 256)
+
+	in := bufio.NewReader(r)
+	for {
+		b, err := in.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		freq[b]++
+	}
+
+	return newStats(freq), nil
+}
+
+func newStats(freq []uint64) *Stats {
+
+	s := &Stats{Symbols: []SymbolStats{}}
+
+	for _, f := range freq {
+		s.Length += f
+	}
+
+	lengths := huffmanCodeLengths(freq, maxCodeLength)
+	codes := canonicalCodes(lengths)
+
+	bits := uint64(0)
+	for symbol, f := range freq {
+		if f == 0 {
+			continue
+		}
+
+		code := strings.Builder{}
+		for _, bit := range codes[byte(symbol)] {
+			if bit {
+				code.WriteByte('1')
+			} else {
+				code.WriteByte('0')
+			}
+		}
+
+		s.Symbols = append(s.Symbols, SymbolStats{
+			Symbol:     byte(symbol),
+			Frequency:  f,
+			CodeLength: int(lengths[symbol]),
+			Code:       code.String(),
+			Bits:       f * uint64(lengths[symbol]),
+		})
+
+		p := float64(f) / float64(s.Length)
+		s.Entropy -= p * math.Log2(p)
+		bits += f * uint64(lengths[symbol])
+		s.MaxCodeLength = max(s.MaxCodeLength, int(lengths[symbol]))
+	}
+
+	if root := buildTree(freq); root != nil {
+		s.TreeDepth = root.depth
+	}
+
+	hdr := header{length: s.Length, lengths: lengths}
+	s.HeaderBytes = uint64(len(appendChecksum(marshalPreamble(0))) + len(hdr.marshal()) + 4)
+	s.DataBytes = (bits + uint64(padding(bits))) / 8
+
+	if s.Length > 0 {
+		s.BitsPerSymbol = float64(bits) / float64(s.Length)
+		s.Ratio = float64(s.HeaderBytes+s.DataBytes) / float64(s.Length)
+	}
+	if s.BitsPerSymbol > 0 {
+		s.Efficiency = s.Entropy / s.BitsPerSymbol
+	}
+
+	return s
+}
+
+func (s *Stats) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	return enc.Encode(s)
+}
+
+func (s *Stats) writeText(w io.Writer) error {
+
+	out := bufio.NewWriter(w)
+
+	fmt.Fprintf(out, "%8s %12s %6s  %-15s %14s\n", "symbol", "frequency", "length", "code", "bits")
+	for _, sym := range s.Symbols {
+		fmt.Fprintf(out, "%8s %12d %6d  %-15s %14d\n", symbolName(sym.Symbol), sym.Frequency, sym.CodeLength, sym.Code, sym.Bits)
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "length:          %d bytes, %d distinct symbols\n", s.Length, len(s.Symbols))
+	fmt.Fprintf(out, "entropy:         %.4f bits/symbol\n", s.Entropy)
+	fmt.Fprintf(out, "achieved:        %.4f bits/symbol (%.2f%% efficiency)\n", s.BitsPerSymbol, s.Efficiency*100)
+	fmt.Fprintf(out, "tree depth:      %d (codes limited to %d, longest %d)\n", s.TreeDepth, maxCodeLength, s.MaxCodeLength)
+	fmt.Fprintf(out, "compressed size: %d bytes header + %d bytes data\n", s.HeaderBytes, s.DataBytes)
+	fmt.Fprintf(out, "compression rate: %0.2f%%\n", s.Ratio*100)
+
+	return out.Flush()
+}
+
+// symbolName prints printable ASCII as is and everything else in hex.
+func symbolName(b byte) string {
+	if b > ' ' && b < 0x7F {
+		return fmt.Sprintf("'%c'", b)
+	}
+	return fmt.Sprintf("0x%02X", b)
+}
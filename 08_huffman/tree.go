@@ -0,0 +1,101 @@
+package main
+
+import (
+	"container/heap"
+)
+
+type node struct {
+	weight      uint64
+	element     byte
+	isLeaf      bool
+	depth       int
+	left, right *node
+
+	// order breaks ties between nodes of equal weight: leaves are ordered
+	// by byte value, internal nodes by creation and after all leaves
+	order int
+}
+
+// nodeQueue is a min-heap of nodes ordered by weight and then by order, so
+// the tree does not depend on any sorting implementation details.
+type nodeQueue []*node
+
+func (q nodeQueue) Len() int {
+	return len(q)
+}
+
+func (q nodeQueue) Less(i, j int) bool {
+	if q[i].weight != q[j].weight {
+		return q[i].weight < q[j].weight
+	}
+	return q[i].order < q[j].order
+}
+
+func (q nodeQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+}
+
+func (q *nodeQueue) Push(x any) {
+	*q = append(*q, x.(*node))
+}
+
+func (q *nodeQueue) Pop() any {
+	old := *q
+	n := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return n
+}
+
+// frequencies counts the occurrences of every byte value in text.
+func frequencies(text []byte) []uint64 {
+	freq := make([]uint64, 256)
+	for _, b := range text {
+		freq[b]++
+	}
+	return freq
+}
+
+// buildTree creates the Huffman tree for the byte frequencies freq.
+func buildTree(freq []uint64) *node {
+
+	nodes := &nodeQueue{}
+
+	for i, f := range freq {
+		if f != 0 {
+			n := node{
+				weight:  f,
+				element: byte(i),
+				isLeaf:  true,
+				depth:   0,
+				left:    nil,
+				right:   nil,
+				order:   i,
+			}
+			heap.Push(nodes, &n)
+		}
+	}
+
+	if nodes.Len() == 0 {
+		return nil
+	}
+
+	// create Huffman tree
+	for order := len(freq); nodes.Len() > 1; order++ {
+
+		left := heap.Pop(nodes).(*node)
+		right := heap.Pop(nodes).(*node)
+
+		next := &node{
+			weight:  left.weight + right.weight,
+			element: 0,
+			isLeaf:  false,
+			depth:   max(left.depth, right.depth) + 1,
+			left:    left,
+			right:   right,
+			order:   order,
+		}
+		heap.Push(nodes, next)
+	}
+
+	return heap.Pop(nodes).(*node)
+}
@@ -0,0 +1,129 @@
+package gzip
+
+import (
+	"bufio"
+	"io"
+)
+
+// bitstream reads bits least-significant bit first, pulling bytes from the
+// underlying reader on demand into a small bit buffer.
+type bitstream struct {
+	r    *bufio.Reader
+	acc  uint64
+	nacc int
+	ptr  int
+
+	recording bool
+	record    []byte
+}
+
+func newBitstream(r io.Reader) *bitstream {
+	s := &bitstream{r: bufio.NewReader(r)}
+	return s
+}
+
+// startRecording keeps a copy of every byte read from now on until
+// stopRecording is called.
+func (s *bitstream) startRecording() {
+	s.recording = true
+	s.record = []byte{}
+}
+
+func (s *bitstream) stopRecording() []byte {
+	s.recording = false
+	return s.record
+}
+
+func (s *bitstream) skipToNextByte() {
+	for (s.ptr % 8) > 0 {
+		debug('x')
+		s.acc >>= 1
+		s.nacc--
+		s.ptr++
+	}
+}
+
+// fill buffers at least n bits unless the input ends first.
+func (s *bitstream) fill(n int) error {
+	for s.nacc < n {
+		c, err := s.r.ReadByte()
+		if err == io.EOF {
+			return newTruncatedFileError()
+		} else if err != nil {
+			return err
+		}
+		if s.recording {
+			s.record = append(s.record, c)
+		}
+		s.acc |= uint64(c) << s.nacc
+		s.nacc += 8
+	}
+	return nil
+}
+
+// peekBits returns the next n bits without consuming them. Bits beyond the
+// end of the input read as zero.
+func (s *bitstream) peekBits(n int) uint64 {
+	s.fill(n)
+	return s.acc & (1<<n - 1)
+}
+
+// skipBits consumes the next n bits.
+func (s *bitstream) skipBits(n int) error {
+
+	if err := s.fill(n); err != nil {
+		return err
+	}
+
+	for i := 0; i < n && DEBUG; i++ {
+		debug((s.acc >> i) & 1)
+		if (s.ptr+i+1)%8 == 0 {
+			debug(" ")
+		}
+	}
+
+	s.acc >>= n
+	s.nacc -= n
+	s.ptr += n
+
+	return nil
+}
+
+func (s *bitstream) nextBool() (bool, error) {
+	b, err := s.nextBits(1)
+	return b == 1, err
+}
+
+func (s *bitstream) nextByte() (byte, error) {
+	b, err := s.nextBits(8)
+	return byte(b), err
+}
+
+func (s *bitstream) nextBytes(n int) ([]byte, error) {
+	bs := make([]byte, n)
+	for i := range n {
+		b, err := s.nextByte()
+		if err != nil {
+			return nil, err
+		}
+		bs[i] = b
+	}
+	return bs, nil
+}
+
+func (s *bitstream) nextBits(n int) (uint64, error) {
+	bits := s.peekBits(n)
+	return bits, s.skipBits(n)
+}
+
+func (s *bitstream) neof() bool {
+	if s.nacc > 0 {
+		return true
+	}
+	_, err := s.r.Peek(1)
+	return err == nil
+}
+
+func (s *bitstream) eof() bool {
+	return !s.neof()
+}
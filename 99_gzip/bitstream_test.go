@@ -1,6 +1,7 @@
-package main
+package gzip
 
 import (
+	"bytes"
 	"testing"
 )
 
@@ -21,10 +22,10 @@ func Test_bitstream_nextBits(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := &bitstream{
-				data: tt.fields.data,
-			}
-			if got := s.nextBits(tt.args.n); got != tt.want {
+			s := newBitstream(bytes.NewReader(tt.fields.data))
+			if got, err := s.nextBits(tt.args.n); err != nil {
+				t.Fatal(err)
+			} else if got != tt.want {
 				t.Errorf("bitstream.nextBits() = %08b, want %08b", got, tt.want)
 			}
 		})
@@ -44,10 +45,10 @@ func Test_bitstream_nextByte(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := &bitstream{
-				data: tt.fields.data,
-			}
-			if got := s.nextByte(); got != tt.want {
+			s := newBitstream(bytes.NewReader(tt.fields.data))
+			if got, err := s.nextByte(); err != nil {
+				t.Fatal(err)
+			} else if got != tt.want {
 				t.Errorf("bitstream.nextByte() = %v, want %v", got, tt.want)
 			}
 		})
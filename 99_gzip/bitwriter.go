@@ -0,0 +1,55 @@
+package gzip
+
+import (
+	"bufio"
+	"io"
+)
+
+// bitwriter is the counterpart of bitstream: it packs bits into bytes
+// starting with the least-significant bit, as required by RFC 1951.
+type bitwriter struct {
+	w     *bufio.Writer
+	acc   uint64
+	nbits int
+}
+
+func newBitwriter(w io.Writer) *bitwriter {
+	return &bitwriter{w: bufio.NewWriter(w)}
+}
+
+// writeBits writes the n lowest bits of bits, least-significant bit first.
+func (b *bitwriter) writeBits(bits uint64, n int) {
+	b.acc |= bits << b.nbits
+	b.nbits += n
+	for b.nbits >= 8 {
+		b.w.WriteByte(byte(b.acc))
+		b.acc >>= 8
+		b.nbits -= 8
+	}
+}
+
+// writeCode writes the Huffman code of length n, most-significant bit first.
+func (b *bitwriter) writeCode(code uint64, n int) {
+	b.writeBits(reverseBits(code, n), n)
+}
+
+func (b *bitwriter) writeBytes(bs []byte) {
+	b.alignToByte()
+	b.w.Write(bs)
+}
+
+func (b *bitwriter) alignToByte() {
+	if b.nbits > 0 {
+		b.writeBits(0, 8-b.nbits)
+	}
+}
+
+// pendingBits returns the number of bits written since the last byte boundary.
+func (b *bitwriter) pendingBits() int {
+	return b.nbits
+}
+
+func (b *bitwriter) flush() error {
+	b.alignToByte()
+	return b.w.Flush()
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	gzip "go-gzip"
+)
+
+type lister struct {
+	count                    int
+	compressed, uncompressed int64
+	overhead                 int64
+}
+
+func newLister() *lister {
+	return &lister{}
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// headerSize returns the number of bytes of a member spent on the header
+// and the trailer.
+func headerSize(info map[string][]byte) int64 {
+	size := int64(10 + 8)
+	if fextra, ok := info["fextra"]; ok {
+		size += int64(2 + len(fextra))
+	}
+	if fname, ok := info["fname"]; ok {
+		size += int64(len(fname) + 1)
+	}
+	if fcomment, ok := info["fcomment"]; ok {
+		size += int64(len(fcomment) + 1)
+	}
+	if fhcrc, ok := info["fhcrc"]; ok {
+		size += int64(len(fhcrc))
+	}
+	return size
+}
+
+func (l *lister) list(r io.Reader, name string) {
+
+	in := &countingReader{r: r}
+	out := new(countingWriter)
+
+	members, err := gzip.DecompressMembers(out, in)
+	if err != nil {
+		errorf(name, err)
+		return
+	}
+
+	overhead := int64(0)
+	for _, info := range members {
+		overhead += headerSize(info)
+	}
+
+	if l.count == 0 {
+		fmt.Printf("%19s %19s  ratio uncompressed_name\n", "compressed", "uncompressed")
+	}
+
+	l.print(in.n, out.n, overhead, name)
+
+	l.count++
+	l.compressed += in.n
+	l.uncompressed += out.n
+	l.overhead += overhead
+}
+
+func (l *lister) print(compressed, uncompressed, overhead int64, name string) {
+
+	ratio := 0.0
+	if uncompressed > 0 {
+		ratio = 100 * float64(uncompressed-(compressed-overhead)) / float64(uncompressed)
+	}
+
+	fmt.Printf("%19d %19d %5.1f%% %s\n", compressed, uncompressed, ratio, name)
+}
+
+func (l *lister) printTotals() {
+	if l.count > 1 {
+		l.print(l.compressed, l.uncompressed, l.overhead, "(totals)")
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gzip "go-gzip"
+)
+
+// exit codes as used by GNU gzip
+const (
+	exitOK      = 0
+	exitError   = 1
+	exitWarning = 2
+)
+
+type options struct {
+	stdout     bool
+	decompress bool
+	keep       bool
+	list       bool
+	test       bool
+	recursive  bool
+	force      bool
+	processes  int
+	inspect    bool
+}
+
+var (
+	opts     options
+	exitCode = exitOK
+	listing  = newLister()
+)
+
+func main() {
+
+	boolFlag(&opts.stdout, "write on standard output, keep original files unchanged", "c", "stdout", "to-stdout")
+	boolFlag(&opts.decompress, "decompress", "d", "decompress", "uncompress")
+	boolFlag(&opts.force, "force overwrite of output file", "f", "force")
+	boolFlag(&opts.keep, "keep (don't delete) input files", "k", "keep")
+	boolFlag(&opts.list, "list compressed file contents", "l", "list")
+	boolFlag(&opts.recursive, "operate recursively on directories", "r", "recursive")
+	boolFlag(&opts.test, "test compressed file integrity", "t", "test")
+	flag.IntVar(&opts.processes, "p", 1, "compress with this many goroutines in parallel, 0 for all cores")
+	flag.BoolVar(&opts.inspect, "inspect", false, "print a JSON report per compressed block")
+	flag.BoolVar(&gzip.DEBUG, "debug", false, "debug")
+
+	flag.CommandLine.Parse(expandShortFlags(os.Args[1:]))
+
+	paths := flag.Args()
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+
+	for _, path := range paths {
+		process(path)
+	}
+
+	if opts.list {
+		listing.printTotals()
+	}
+
+	os.Exit(exitCode)
+}
+
+func boolFlag(p *bool, usage string, names ...string) {
+	for _, name := range names {
+		flag.BoolVar(p, name, false, usage)
+	}
+}
+
+// expandShortFlags splits combined single-letter flags such as -dc into -d -c.
+func expandShortFlags(args []string) []string {
+	expanded := []string{}
+	for i, arg := range args {
+		if arg == "--" {
+			return append(expanded, args[i:]...)
+		}
+		if len(arg) > 2 && arg[0] == '-' && arg[1] != '-' && isShortFlagGroup(arg[1:]) {
+			for _, c := range arg[1:] {
+				expanded = append(expanded, "-"+string(c))
+			}
+			continue
+		}
+		expanded = append(expanded, arg)
+	}
+	return expanded
+}
+
+func isShortFlagGroup(s string) bool {
+	for _, c := range s {
+		if flag.Lookup(string(c)) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func warnf(format string, a ...any) {
+	fmt.Fprintf(os.Stderr, "gzip: "+format+"\n", a...)
+	if exitCode == exitOK {
+		exitCode = exitWarning
+	}
+}
+
+func errorf(path string, err error) {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+	fmt.Fprintf(os.Stderr, "gzip: %s: %v\n", path, err)
+	exitCode = exitError
+}
+
+func process(path string) {
+
+	if path == "-" {
+		processStdin()
+		return
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		errorf(path, err)
+		return
+	}
+
+	if info.IsDir() {
+		if !opts.recursive {
+			warnf("%s is a directory -- ignored", path)
+			return
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			errorf(path, err)
+			return
+		}
+		for _, entry := range entries {
+			process(filepath.Join(path, entry.Name()))
+		}
+		return
+	}
+
+	if !info.Mode().IsRegular() {
+		warnf("%s is not a directory or a regular file - ignored", path)
+		return
+	}
+
+	switch {
+	case opts.inspect:
+		inspectFile(path)
+	case opts.list:
+		listFile(path)
+	case opts.test:
+		testFile(path)
+	case opts.decompress:
+		decompressFile(path, info)
+	default:
+		compressFile(path, info)
+	}
+}
+
+func processStdin() {
+
+	var err error
+
+	switch {
+	case opts.list:
+		listing.list(os.Stdin, "stdout")
+		return
+	case opts.inspect:
+		err = gzip.Inspect(os.Stdout, os.Stdin)
+	case opts.test:
+		err = gzip.Decompress(io.Discard, os.Stdin)
+	case opts.decompress:
+		err = gzip.Decompress(os.Stdout, os.Stdin)
+	default:
+		err = compress(os.Stdout, os.Stdin, gzip.Header{})
+	}
+
+	if err != nil {
+		errorf("stdin", err)
+	}
+}
+
+func testFile(path string) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		errorf(path, err)
+		return
+	}
+	defer f.Close()
+
+	if err := gzip.Decompress(io.Discard, f); err != nil {
+		errorf(path, err)
+	}
+}
+
+func inspectFile(path string) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		errorf(path, err)
+		return
+	}
+	defer f.Close()
+
+	if err := gzip.Inspect(os.Stdout, f); err != nil {
+		errorf(path, err)
+	}
+}
+
+func listFile(path string) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		errorf(path, err)
+		return
+	}
+	defer f.Close()
+
+	name, _ := stripSuffix(path)
+	listing.list(f, name)
+}
+
+// stripSuffix returns the name of the decompressed file.
+func stripSuffix(path string) (string, bool) {
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		return strings.TrimSuffix(path, ".gz"), true
+	case strings.HasSuffix(path, ".tgz"):
+		return strings.TrimSuffix(path, ".tgz") + ".tar", true
+	}
+	return path, false
+}
+
+func hasSuffix(path string) bool {
+	_, ok := stripSuffix(path)
+	return ok
+}
+
+func compressFile(path string, info fs.FileInfo) {
+
+	if hasSuffix(path) {
+		if !opts.recursive {
+			fmt.Fprintf(os.Stderr, "gzip: %s already has .gz suffix -- unchanged\n", path)
+		}
+		return
+	}
+
+	hdr := gzip.Header{
+		Name:    filepath.Base(path),
+		ModTime: info.ModTime(),
+	}
+
+	transform(path, path+".gz", info, func(w io.Writer, r io.Reader) error {
+		return compress(w, r, hdr)
+	})
+}
+
+func compress(w io.Writer, r io.Reader, hdr gzip.Header) error {
+	if opts.processes == 1 {
+		return gzip.Compress(w, r, hdr)
+	}
+	return gzip.CompressParallel(w, r, hdr, opts.processes)
+}
+
+func decompressFile(path string, info fs.FileInfo) {
+
+	// the suffix only matters for naming the output file
+	outpath, ok := stripSuffix(path)
+	if !ok && !opts.stdout {
+		if !opts.recursive {
+			warnf("%s: unknown suffix -- ignored", path)
+		}
+		return
+	}
+
+	transform(path, outpath, info, gzip.Decompress)
+}
+
+// transform reads path, writes the result of fun to outpath (or stdout) and
+// removes path unless asked to keep it.
+func transform(path string, outpath string, info fs.FileInfo, fun func(io.Writer, io.Reader) error) {
+
+	in, err := os.Open(path)
+	if err != nil {
+		errorf(path, err)
+		return
+	}
+	defer in.Close()
+
+	if opts.stdout {
+		if err := fun(os.Stdout, in); err != nil {
+			errorf(path, err)
+		}
+		return
+	}
+
+	if _, err := os.Lstat(outpath); err == nil && !opts.force {
+		warnf("%s already exists; not overwritten", outpath)
+		return
+	}
+
+	out, err := os.OpenFile(outpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		errorf(outpath, err)
+		return
+	}
+
+	if err := fun(out, in); err != nil {
+		out.Close()
+		os.Remove(outpath)
+		errorf(path, err)
+		return
+	}
+
+	if err := out.Close(); err != nil {
+		os.Remove(outpath)
+		errorf(outpath, err)
+		return
+	}
+
+	// like GNU gzip, the output inherits the timestamps and mode of the input
+	if err := os.Chtimes(outpath, info.ModTime(), info.ModTime()); err != nil {
+		errorf(outpath, err)
+	}
+
+	if !opts.keep {
+		in.Close()
+		if err := os.Remove(path); err != nil {
+			errorf(path, err)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package gzip
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"sort"
+	"time"
+)
+
+const (
+	// maxBlockLength bounds the uncompressed size of a block so that every
+	// block also fits into a single stored block.
+	maxBlockLength = 0xFFFF
+
+	numLitCodes  = 286
+	numDistCodes = 30
+	numClenCodes = 19
+
+	maxCodeLength     = 15
+	maxClenCodeLength = 7
+)
+
+var (
+	fixedHuffmanlitEncoding  = newHuffmanEncoding(fixedHuffmanlitCodeLengths())
+	fixedHuffmanDistEncoding = newHuffmanEncoding(fixedHuffmanDistCodeLengths())
+)
+
+// Header holds the optional fields of the gzip header written by Compress.
+type Header struct {
+	Name    string
+	ModTime time.Time
+}
+
+// Compress reads r until EOF and writes it to w as a single gzip member.
+func Compress(w io.Writer, r io.Reader, hdr Header) error {
+
+	c := newCompressor(w)
+
+	c.writeHeader(hdr)
+
+	if err := c.writeData(r); err != nil {
+		return err
+	}
+
+	c.writeTrailer()
+
+	return c.ostream.flush()
+}
+
+type compressor struct {
+	ostream *bitwriter
+	matcher *lz77Matcher
+	crc     uint32
+	size    uint32
+}
+
+func newCompressor(w io.Writer) *compressor {
+	return &compressor{
+		ostream: newBitwriter(w),
+		matcher: newLz77Matcher(),
+	}
+}
+
+func (c *compressor) writeHeader(hdr Header) {
+
+	flags := byte(0)
+	if hdr.Name != "" {
+		flags |= 0x08
+	}
+
+	mtime := uint32(0)
+	if !hdr.ModTime.IsZero() {
+		mtime = uint32(hdr.ModTime.Unix())
+	}
+
+	header := []byte{0x1F, 0x8B, 0x08, flags}
+	header = binary.LittleEndian.AppendUint32(header, mtime)
+	header = append(header, 0x00, 0x03) // XFL, OS = Unix
+
+	if hdr.Name != "" {
+		header = append(header, hdr.Name...)
+		header = append(header, 0x00)
+	}
+
+	c.ostream.writeBytes(header)
+}
+
+func (c *compressor) writeTrailer() {
+	trailer := binary.LittleEndian.AppendUint32(nil, c.crc)
+	trailer = binary.LittleEndian.AppendUint32(trailer, c.size)
+	c.ostream.writeBytes(trailer)
+}
+
+func (c *compressor) writeData(r io.Reader) error {
+
+	block, err := readBlock(r)
+	if err != nil {
+		return err
+	}
+
+	for {
+		next, err := readBlock(r)
+		if err != nil {
+			return err
+		}
+
+		final := len(next) == 0
+		c.writeBlock(block, final)
+		if final {
+			return nil
+		}
+
+		block = next
+	}
+}
+
+func readBlock(r io.Reader) ([]byte, error) {
+	block := make([]byte, maxBlockLength)
+	n, err := io.ReadFull(r, block)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return block[:n], err
+}
+
+// writeBlock emits data as a stored, fixed or dynamic Huffman block,
+// whichever is smallest.
+func (c *compressor) writeBlock(data []byte, final bool) {
+
+	c.crc = crc32.Update(c.crc, crc32.IEEETable, data)
+	c.size += uint32(len(data))
+
+	tokens := c.matcher.tokenize(data)
+
+	litFreqs, distFreqs, extraBits := tokenFrequencies(tokens)
+
+	dyn := newDynamicHeader(litFreqs, distFreqs)
+
+	storedBits := 3 + (8-(c.ostream.pendingBits()+3)%8)%8 + 32 + 8*len(data)
+	fixedBits := 3 + fixedHuffmanlitEncoding.bits(litFreqs) + fixedHuffmanDistEncoding.bits(distFreqs) + extraBits
+	dynamicBits := 3 + dyn.bits() + dyn.lit.bits(litFreqs) + dyn.dist.bits(distFreqs) + extraBits
+
+	bfinal := uint64(0)
+	if final {
+		bfinal = 1
+	}
+	c.ostream.writeBits(bfinal, 1)
+
+	switch {
+	case storedBits <= fixedBits && storedBits <= dynamicBits:
+		c.ostream.writeBits(0b00, 2)
+		c.writeNoCompression(data)
+	case fixedBits <= dynamicBits:
+		c.ostream.writeBits(0b01, 2)
+		c.writeHuffmanCodes(tokens, fixedHuffmanlitEncoding, fixedHuffmanDistEncoding)
+	default:
+		c.ostream.writeBits(0b10, 2)
+		dyn.write(c.ostream)
+		c.writeHuffmanCodes(tokens, dyn.lit, dyn.dist)
+	}
+}
+
+// writeSyncFlush emits an empty stored block, which aligns the output to a
+// byte boundary.
+func (c *compressor) writeSyncFlush() {
+	c.ostream.writeBits(0, 1)
+	c.ostream.writeBits(0b00, 2)
+	c.writeNoCompression(nil)
+}
+
+func (c *compressor) writeNoCompression(data []byte) {
+	length := uint16(len(data))
+	c.ostream.alignToByte()
+	c.ostream.writeBits(uint64(length), 16)
+	c.ostream.writeBits(uint64(^length), 16)
+	c.ostream.writeBytes(data)
+}
+
+func (c *compressor) writeHuffmanCodes(tokens []lz77Token, lit, dist huffmanEncoding) {
+
+	for _, t := range tokens {
+
+		if t.length == 0 {
+			lit.write(c.ostream, uint64(t.literal))
+			continue
+		}
+
+		lencode, extra, nExtraBits := lengthSymbol(t.length)
+		lit.write(c.ostream, lencode)
+		c.ostream.writeBits(extra, nExtraBits)
+
+		distcode, extra, nExtraBits := distanceSymbol(t.distance)
+		dist.write(c.ostream, distcode)
+		c.ostream.writeBits(extra, nExtraBits)
+	}
+
+	lit.write(c.ostream, 256) // end-of-block
+}
+
+// tokenFrequencies counts the literal/length and distance symbols of tokens
+// (including the end-of-block symbol) and the number of extra bits they need.
+func tokenFrequencies(tokens []lz77Token) ([]int, []int, int) {
+
+	litFreqs := make([]int, numLitCodes)
+	distFreqs := make([]int, numDistCodes)
+	extraBits := 0
+
+	for _, t := range tokens {
+
+		if t.length == 0 {
+			litFreqs[t.literal]++
+			continue
+		}
+
+		lencode, _, nLenBits := lengthSymbol(t.length)
+		distcode, _, nDistBits := distanceSymbol(t.distance)
+
+		litFreqs[lencode]++
+		distFreqs[distcode]++
+		extraBits += nLenBits + nDistBits
+	}
+
+	litFreqs[256]++
+
+	return litFreqs, distFreqs, extraBits
+}
+
+// lengthSymbol returns the length code for length, the value of its extra
+// bits and the number of extra bits.
+func lengthSymbol(length int) (uint64, uint64, int) {
+	i := sort.Search(len(baseHuffmanLengths), func(i int) bool {
+		return baseHuffmanLengths[i] > uint64(length)
+	}) - 1
+	lencode := uint64(257 + i)
+	return lencode, uint64(length) - baseHuffmanLengths[i], lengthExtraBits(lencode)
+}
+
+// distanceSymbol returns the distance code for distance, the value of its
+// extra bits and the number of extra bits.
+func distanceSymbol(distance int) (uint64, uint64, int) {
+	i := sort.Search(len(baseHuffmanDistances), func(i int) bool {
+		return baseHuffmanDistances[i] > uint64(distance)
+	}) - 1
+	distcode := uint64(i)
+	return distcode, uint64(distance) - baseHuffmanDistances[i], distanceExtraBits(distcode)
+}
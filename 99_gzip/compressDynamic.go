@@ -0,0 +1,124 @@
+package gzip
+
+// clenSymbol is a run-length encoded entry of the code length sequence.
+type clenSymbol struct {
+	code       uint64
+	extra      uint64
+	nExtraBits int
+}
+
+type dynamicHeader struct {
+	lit, dist   huffmanEncoding
+	clen        huffmanEncoding
+	nlit, ndist int
+	nclen       int
+	symbols     []clenSymbol
+}
+
+func newDynamicHeader(litFreqs, distFreqs []int) *dynamicHeader {
+
+	h := &dynamicHeader{
+		lit:  newHuffmanEncoding(huffmanCodeLengths(litFreqs, maxCodeLength)),
+		dist: newHuffmanEncoding(huffmanCodeLengths(distFreqs, maxCodeLength)),
+	}
+
+	h.nlit = 257
+	for i := range h.lit.lengths {
+		if h.lit.lengths[i] != 0 {
+			h.nlit = max(h.nlit, i+1)
+		}
+	}
+
+	h.ndist = 1
+	for i := range h.dist.lengths {
+		if h.dist.lengths[i] != 0 {
+			h.ndist = max(h.ndist, i+1)
+		}
+	}
+
+	codeLengths := append(append([]int{}, h.lit.lengths[:h.nlit]...), h.dist.lengths[:h.ndist]...)
+	h.symbols = runLengthEncode(codeLengths)
+
+	clenFreqs := make([]int, numClenCodes)
+	for _, s := range h.symbols {
+		clenFreqs[s.code]++
+	}
+	h.clen = newHuffmanEncoding(huffmanCodeLengths(clenFreqs, maxClenCodeLength))
+
+	h.nclen = 4
+	for i, idx := range clenIdxs {
+		if h.clen.lengths[idx] != 0 {
+			h.nclen = max(h.nclen, i+1)
+		}
+	}
+
+	return h
+}
+
+// runLengthEncode compresses a code length sequence using the repeat codes
+// 16 (previous length), 17 and 18 (zeros).
+func runLengthEncode(codeLengths []int) []clenSymbol {
+
+	symbols := []clenSymbol{}
+
+	for i := 0; i < len(codeLengths); {
+
+		l := codeLengths[i]
+		run := 1
+		for i+run < len(codeLengths) && codeLengths[i+run] == l {
+			run++
+		}
+		i += run
+
+		if l == 0 {
+			for run >= 11 {
+				n := min(run, 138)
+				symbols = append(symbols, clenSymbol{18, uint64(n - 11), 7})
+				run -= n
+			}
+			if run >= 3 {
+				symbols = append(symbols, clenSymbol{17, uint64(run - 3), 3})
+				run = 0
+			}
+		} else {
+			symbols = append(symbols, clenSymbol{code: uint64(l)})
+			run--
+			for run >= 3 {
+				n := min(run, 6)
+				symbols = append(symbols, clenSymbol{16, uint64(n - 3), 2})
+				run -= n
+			}
+		}
+
+		for range run {
+			symbols = append(symbols, clenSymbol{code: uint64(l)})
+		}
+	}
+
+	return symbols
+}
+
+// bits returns the size of the header without the block header bits.
+func (h *dynamicHeader) bits() int {
+	n := 5 + 5 + 4 + 3*h.nclen
+	for _, s := range h.symbols {
+		n += h.clen.lengths[s.code] + s.nExtraBits
+	}
+	return n
+}
+
+func (h *dynamicHeader) write(s *bitwriter) {
+
+	s.writeBits(uint64(h.nlit-257), 5)
+	s.writeBits(uint64(h.ndist-1), 5)
+	s.writeBits(uint64(h.nclen-4), 4)
+
+	for _, idx := range clenIdxs[:h.nclen] {
+		s.writeBits(uint64(h.clen.lengths[idx]), 3)
+	}
+
+	for _, sym := range h.symbols {
+		h.clen.write(s, sym.code)
+		s.writeBits(sym.extra, sym.nExtraBits)
+	}
+}
@@ -0,0 +1,145 @@
+package gzip
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io"
+	"runtime"
+)
+
+// parallelChunkLength is the amount of input compressed by a single worker.
+const parallelChunkLength = 0x20000
+
+type chunkJob struct {
+	dict, data []byte
+	last       bool
+	result     chan chunkResult
+}
+
+type chunkResult struct {
+	data []byte
+	err  error
+}
+
+// CompressParallel works like Compress but splits the input into chunks that
+// are compressed independently by workers goroutines (all cores if workers
+// < 1). Every chunk uses the last maxHistoryLength bytes of the previous one
+// as dictionary and ends on a byte boundary with an empty stored block (a
+// sync flush), so the compressed chunks concatenate into a single member.
+func CompressParallel(w io.Writer, r io.Reader, hdr Header, workers int) error {
+
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+
+	c := newCompressor(w)
+
+	c.writeHeader(hdr)
+
+	jobs := make(chan chunkJob)
+	results := make(chan chan chunkResult, workers)
+
+	for range workers {
+		go func() {
+			for job := range jobs {
+				data, err := compressChunk(job.dict, job.data, job.last)
+				job.result <- chunkResult{data, err}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		defer close(results)
+		c.readChunks(r, jobs, results)
+	}()
+
+	// results arrive in input order, workers may still be busy with later chunks
+	var err error
+	for result := range results {
+		res := <-result
+		if err == nil {
+			err = res.err
+		}
+		if err == nil {
+			c.ostream.writeBytes(res.data)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	c.writeTrailer()
+
+	return c.ostream.flush()
+}
+
+// readChunks splits r into chunks and hands them to the workers. The checksum
+// of the uncompressed data is computed on the way.
+func (c *compressor) readChunks(r io.Reader, jobs chan<- chunkJob, results chan<- chan chunkResult) {
+
+	dict := []byte{}
+
+	chunk, err := readChunk(r)
+
+	for {
+		if err != nil {
+			result := make(chan chunkResult, 1)
+			result <- chunkResult{err: err}
+			results <- result
+			return
+		}
+
+		var next []byte
+		next, err = readChunk(r)
+		last := err == nil && len(next) == 0
+
+		c.crc = crc32.Update(c.crc, crc32.IEEETable, chunk)
+		c.size += uint32(len(chunk))
+
+		result := make(chan chunkResult, 1)
+		results <- result
+		jobs <- chunkJob{dict, chunk, last, result}
+
+		if last {
+			return
+		}
+
+		dict = append(dict, chunk...)
+		dict = dict[max(0, len(dict)-maxHistoryLength):]
+		chunk = next
+	}
+}
+
+func readChunk(r io.Reader) ([]byte, error) {
+	chunk := make([]byte, parallelChunkLength)
+	n, err := io.ReadFull(r, chunk)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return chunk[:n], err
+}
+
+func compressChunk(dict, data []byte, last bool) ([]byte, error) {
+
+	buf := new(bytes.Buffer)
+
+	c := newCompressor(buf)
+	c.matcher.preset(dict)
+
+	for len(data) > maxBlockLength {
+		c.writeBlock(data[:maxBlockLength], false)
+		data = data[maxBlockLength:]
+	}
+	c.writeBlock(data, last)
+
+	if !last {
+		c.writeSyncFlush()
+	}
+
+	if err := c.ostream.flush(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,92 @@
+package gzip
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestCompressEmpty(t *testing.T) {
+	testhelper_compress(t, []byte{})
+}
+
+func TestCompressSmall(t *testing.T) {
+	testhelper_compressFile(t, "small.txt")
+}
+
+func TestCompressRandom(t *testing.T) {
+	testhelper_compressFile(t, "random.txt")
+}
+
+func TestCompressLong(t *testing.T) {
+	testhelper_compressFile(t, "long.txt")
+}
+
+func TestCompressParallelEmpty(t *testing.T) {
+	testhelper_compressParallel(t, []byte{})
+}
+
+func TestCompressParallelSmall(t *testing.T) {
+	testhelper_compressParallel(t, testhelper_readFile(t, "small.txt"))
+}
+
+func TestCompressParallelLong(t *testing.T) {
+	testhelper_compressParallel(t, testhelper_readFile(t, "long.txt"))
+}
+
+func TestCompressParallelChunkBoundary(t *testing.T) {
+	testhelper_compressParallel(t, testhelper_readFile(t, "long.txt")[:2*parallelChunkLength])
+}
+
+func testhelper_compressFile(t *testing.T, path string) {
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testhelper_compress(t, want)
+}
+
+func testhelper_compress(t *testing.T, want []byte) {
+
+	compressed := new(bytes.Buffer)
+	if err := Compress(compressed, bytes.NewReader(want), Header{Name: "test.txt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	testhelper_roundTrip(t, compressed, want)
+}
+
+func testhelper_compressParallel(t *testing.T, want []byte) {
+
+	compressed := new(bytes.Buffer)
+	if err := CompressParallel(compressed, bytes.NewReader(want), Header{Name: "test.txt"}, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	testhelper_roundTrip(t, compressed, want)
+}
+
+func testhelper_roundTrip(t *testing.T, compressed *bytes.Buffer, want []byte) {
+
+	// round trip through our own decompressor
+	w := new(bytes.Buffer)
+	DEBUG = false
+	if err := Decompress(w, bytes.NewReader(compressed.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if have := w.Bytes(); !bytes.Equal(have, want) {
+		t.Fatalf("decompress: have %d bytes, want %d bytes", len(have), len(want))
+	}
+
+	// round trip through the system gzip
+	cmd := exec.Command("gzip", "-d", "-c")
+	cmd.Stdin = bytes.NewReader(compressed.Bytes())
+	have, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(have, want) {
+		t.Fatalf("gzip -d: have %d bytes, want %d bytes", len(have), len(want))
+	}
+}
@@ -0,0 +1,213 @@
+package gzip
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"slices"
+	"time"
+)
+
+// Decompress decodes the gzip stream r and writes the uncompressed data to w.
+func Decompress(w io.Writer, r io.Reader) error {
+	_, err := DecompressMembers(w, r)
+	return err
+}
+
+// DecompressMembers decodes all gzip members of r one after another, writes
+// their concatenated uncompressed data to w and returns the header info of
+// every member.
+func DecompressMembers(w io.Writer, r io.Reader) ([]map[string][]byte, error) {
+
+	d := newDecompressor(w, r)
+
+	members, err := d.parseMembers()
+
+	return members, d.finish(err)
+}
+
+// NewReader returns a reader that decompresses the gzip stream r on demand.
+// Closing it stops the decompression.
+func NewReader(r io.Reader) io.ReadCloser {
+	return newPipeReader(func(w io.Writer) error {
+		return Decompress(w, r)
+	})
+}
+
+func (d *decompressor) parseMembers() ([]map[string][]byte, error) {
+
+	members := []map[string][]byte{}
+
+	for i := 0; i == 0 || d.istream.neof(); i++ {
+
+		debugln("*** MEMBER", i, "***")
+
+		d.member = i
+
+		if err := d.parseMember(); err != nil {
+			return members, err
+		}
+
+		members = append(members, d.info)
+	}
+
+	return members, nil
+}
+
+func (d *decompressor) parseMember() error {
+
+	d.reset(crc32.NewIEEE())
+
+	if err := d.parseHeader(); err != nil {
+		return err
+	}
+
+	for key, val := range d.info {
+		debugf("[INFO] %s: '%s' %v\n", key, string(val), val)
+	}
+
+	if err := d.parseData(); err != nil {
+		return err
+	}
+
+	if err := d.parseTrailer(); err != nil {
+		return err
+	}
+
+	return nil
+
+}
+
+func (d *decompressor) parseFEXTRA() error {
+	raw, err := d.istream.nextBytes(2)
+	if err != nil {
+		return err
+	}
+	size := binary.LittleEndian.Uint16(raw)
+	d.info["fextra"], err = d.istream.nextBytes(int(size))
+	return err
+}
+
+func (d *decompressor) parseCSTRING(key string) func() error {
+	return func() error {
+		cstr := []byte{}
+		for {
+			c, err := d.istream.nextByte()
+			if err != nil {
+				return err
+			}
+			if c == 0x00 {
+				break
+			}
+			cstr = append(cstr, c)
+		}
+		d.info[key] = cstr
+		return nil
+	}
+}
+
+func (d *decompressor) parseFHCRC() (err error) {
+	d.info["fhcrc"], err = d.istream.nextBytes(2)
+	return err
+}
+
+func (d *decompressor) parseHeader() error {
+
+	parseQueue := []func() error{}
+
+	d.istream.startRecording()
+	defer d.istream.stopRecording()
+
+	// ID1, ID2, CM, FLG, MTIME (4 bytes), XFL, OS
+	header, err := d.istream.nextBytes(10)
+	if err != nil {
+		return err
+	}
+
+	if magic := header[0:2]; !slices.Equal(magic, []byte{0x1F, 0x8B}) {
+		return newCorruptFileError("magic numbers [0x%2X 0x%2X] are not [0x1F 0x8B]", magic[0], magic[1])
+	}
+
+	if method := header[2]; method != 0x08 {
+		return newCorruptFileError("unexpected compression method %x", method)
+	}
+
+	flags := header[3]
+
+	if (flags & 0x01) != 0 {
+		debugln("[INFO]", "FTEXT: If set the uncompressed data needs to be treated as text instead of binary data.")
+	}
+
+	if (flags & 0x04) != 0 {
+		parseQueue = append(parseQueue, d.parseFEXTRA)
+	}
+
+	if (flags & 0x08) != 0 {
+		parseQueue = append(parseQueue, d.parseCSTRING("fname"))
+	}
+
+	if (flags & 0x10) != 0 {
+		parseQueue = append(parseQueue, d.parseCSTRING("fcomment"))
+	}
+
+	if (flags & 0x02) != 0 {
+		parseQueue = append(parseQueue, d.parseFHCRC)
+	}
+
+	if (flags & (0x20 | 0x40 | 0x80)) != 0 {
+		return newCorruptFileError("unexpected flags 0x%02X", flags)
+	}
+
+	mtime := binary.LittleEndian.Uint32(header[4:8])
+	d.info["mtime"] = []byte(fmt.Sprint(time.Unix(int64(mtime), 0)))
+
+	// the extra flags only describe the compression level and are informational
+	d.info["xfl"] = []byte(fmt.Sprintf("0x%02X", header[8]))
+
+	d.info["os"] = []byte(fmt.Sprintf("0x%02X", header[9]))
+
+	for _, parseFun := range parseQueue {
+		if err := parseFun(); err != nil {
+			return err
+		}
+	}
+
+	if fhcrc, ok := d.info["fhcrc"]; ok {
+		// the CRC16 consists of the two least significant bytes of the CRC32
+		// of all header bytes preceding it
+		header := d.istream.stopRecording()
+		header = header[:len(header)-len(fhcrc)]
+		want := binary.LittleEndian.Uint16(fhcrc)
+		if have := uint16(crc32.ChecksumIEEE(header)); have != want {
+			return newCorruptFileError("header CRC16 0x%04X does not match 0x%04X", have, want)
+		}
+	}
+
+	return nil
+}
+
+func (d *decompressor) parseTrailer() error {
+
+	d.istream.skipToNextByte()
+
+	trailer, err := d.istream.nextBytes(8)
+	if err != nil {
+		return err
+	}
+
+	want := binary.LittleEndian.Uint32(trailer[0:4])
+	have := d.checksum.Sum32()
+	debugf("[INFO] crc32: 0x%08X (computed: 0x%08X)\n", want, have)
+	if have != want {
+		return newCorruptFileError("CRC32 0x%08X does not match 0x%08X", have, want)
+	}
+
+	isize := binary.LittleEndian.Uint32(trailer[4:8])
+	debugf("[INFO] isize: %d (computed: %d)\n", isize, d.size)
+	if d.size != isize {
+		return newCorruptFileError("uncompressed size %d does not match ISIZE %d", d.size, isize)
+	}
+
+	return nil
+}
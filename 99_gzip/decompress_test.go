@@ -0,0 +1,323 @@
+package gzip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSmall(t *testing.T) {
+	testhelper_decompress(t, "small.txt")
+}
+
+func TestRandom(t *testing.T) {
+	testhelper_decompress(t, "random.txt")
+}
+
+func TestLong(t *testing.T) {
+	testhelper_decompress(t, "long.txt")
+}
+
+func testhelper_decompress(t *testing.T, path string) {
+	given := testhelper_gzip(t, path)
+
+	w := new(bytes.Buffer)
+
+	DEBUG = false
+	if err := Decompress(w, bytes.NewReader(given)); err != nil {
+		t.Fatal(err)
+	}
+
+	have := w.Bytes()
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(have, want) {
+		for i := range min(len(have), len(want)) {
+			t.Log("have", have[i], "want", want[i])
+			if have[i] != want[i] {
+				t.Log(" <---")
+			}
+			t.Log("\n")
+		}
+		t.Fail()
+	}
+}
+
+func testhelper_gzip(t testing.TB, path string) []byte {
+	cmd := exec.Command("gzip", "-c", path)
+	given, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return given
+}
+
+func testhelper_expectCorrupt(t *testing.T, given []byte) {
+	testhelper_expectCorruptErr(t, Decompress(io.Discard, bytes.NewReader(given)))
+}
+
+func testhelper_expectCorruptErr(t *testing.T, err error) {
+	var corrupt *corruptFileError
+	if !errors.As(err, &corrupt) {
+		t.Fatalf("have error %v, want corruptFileError", err)
+	}
+}
+
+func TestCorruptCRC32(t *testing.T) {
+	given := testhelper_gzip(t, "small.txt")
+	given[len(given)-8] ^= 0x01
+	testhelper_expectCorrupt(t, given)
+}
+
+func TestCorruptISIZE(t *testing.T) {
+	given := testhelper_gzip(t, "small.txt")
+	given[len(given)-1] ^= 0x01
+	testhelper_expectCorrupt(t, given)
+}
+
+func TestCorruptData(t *testing.T) {
+	// random data is kept in stored blocks, so a flipped bit only shows up in the checksum
+	given := testhelper_gzip(t, "random.txt")
+	given[len(given)/2] ^= 0x10
+	testhelper_expectCorrupt(t, given)
+}
+
+func TestFHCRC(t *testing.T) {
+
+	compressed := new(bytes.Buffer)
+	if err := Compress(compressed, strings.NewReader("hello, world"), Header{Name: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	raw := compressed.Bytes()
+
+	// header: 10 fixed bytes followed by the file name "x\0"
+	header := append([]byte{}, raw[:12]...)
+	header[3] |= 0x02
+	crc16 := binary.LittleEndian.AppendUint16(nil, uint16(crc32.ChecksumIEEE(header)))
+
+	given := append(append(header, crc16...), raw[12:]...)
+
+	w := new(bytes.Buffer)
+	if err := Decompress(w, bytes.NewReader(given)); err != nil {
+		t.Fatal(err)
+	}
+	if have := w.String(); have != "hello, world" {
+		t.Fatalf("have '%s'", have)
+	}
+
+	given[12] ^= 0x01
+	testhelper_expectCorrupt(t, given)
+}
+
+func TestExtraFlags(t *testing.T) {
+
+	compressed := new(bytes.Buffer)
+	if err := Compress(compressed, strings.NewReader("hello, world"), Header{}); err != nil {
+		t.Fatal(err)
+	}
+	given := compressed.Bytes()
+
+	// XFL = 2 as written by gzip -9
+	given[8] = 0x02
+
+	w := new(bytes.Buffer)
+	if err := Decompress(w, bytes.NewReader(given)); err != nil {
+		t.Fatal(err)
+	}
+	if have := w.String(); have != "hello, world" {
+		t.Fatalf("have '%s'", have)
+	}
+}
+
+func TestMultiMember(t *testing.T) {
+
+	given := testhelper_gzip(t, "small.txt")
+
+	compressed := new(bytes.Buffer)
+	if err := Compress(compressed, strings.NewReader("hello, world"), Header{Name: "hello.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	given = append(given, compressed.Bytes()...)
+
+	small, err := os.ReadFile("small.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(small, "hello, world"...)
+
+	w := new(bytes.Buffer)
+	members, err := DecompressMembers(w, bytes.NewReader(given))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if have := w.Bytes(); !bytes.Equal(have, want) {
+		t.Fatalf("have %d bytes, want %d bytes", len(have), len(want))
+	}
+
+	if len(members) != 2 {
+		t.Fatalf("have %d members, want 2", len(members))
+	}
+
+	for i, fname := range []string{"small.txt", "hello.txt"} {
+		if have := string(members[i]["fname"]); have != fname {
+			t.Errorf("member %d: have fname '%s', want '%s'", i, have, fname)
+		}
+	}
+}
+
+func TestNewReader(t *testing.T) {
+
+	f, err := os.Open("long.txt.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r := NewReader(f)
+	defer r.Close()
+
+	have, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := os.ReadFile("long.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(have, want) {
+		t.Fatalf("have %d bytes, want %d bytes", len(have), len(want))
+	}
+}
+
+func TestNewReaderClose(t *testing.T) {
+
+	r := NewReader(bytes.NewReader(testhelper_gzip(t, "long.txt")))
+
+	buf := make([]byte, 100)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Read(buf); err == nil {
+		t.Fatal("read after close succeeded")
+	}
+}
+
+func TestInspect(t *testing.T) {
+
+	w := new(bytes.Buffer)
+	if err := Inspect(w, bytes.NewReader(testhelper_gzip(t, "small.txt"))); err != nil {
+		t.Fatal(err)
+	}
+
+	reports := []BlockReport{}
+	dec := json.NewDecoder(w)
+	for dec.More() {
+		var report BlockReport
+		if err := dec.Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		reports = append(reports, report)
+	}
+
+	if len(reports) != 1 {
+		t.Fatalf("have %d blocks, want 1", len(reports))
+	}
+
+	report := reports[0]
+	if !report.BFinal {
+		t.Error("final block not marked as final")
+	}
+	if report.StartBit != 8*len("\x1F\x8B\x08\x08mtimXOsmall.txt\x00") {
+		t.Errorf("block starts at bit %d", report.StartBit)
+	}
+	if report.Matches == 0 || report.Literals == 0 {
+		t.Errorf("have %d literals and %d matches", report.Literals, report.Matches)
+	}
+
+	bytesDecoded := report.Literals
+	for length, count := range report.LengthHistogram {
+		bytesDecoded += length * count
+	}
+	if bytesDecoded != 462 {
+		t.Errorf("block decodes to %d bytes, want 462", bytesDecoded)
+	}
+}
+
+func TestInspectZeroCounts(t *testing.T) {
+
+	// every three letter sequence occurs at most once, so there are no
+	// matches, and HLIT is zero with only the end-of-block code above 255
+	text := []byte("pp")
+	seen := map[string]bool{}
+	for {
+		c := byte('p')
+		for ; c >= 'a' && seen[string(text[len(text)-2:])+string(c)]; c-- {
+		}
+		if c < 'a' {
+			break
+		}
+		seen[string(text[len(text)-2:])+string(c)] = true
+		text = append(text, c)
+	}
+
+	compressed := new(bytes.Buffer)
+	if err := Compress(compressed, bytes.NewReader(text), Header{}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := new(bytes.Buffer)
+	if err := Inspect(w, compressed); err != nil {
+		t.Fatal(err)
+	}
+
+	var report BlockReport
+	if err := json.Unmarshal(w.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.BType != 2 || report.Matches != 0 {
+		t.Fatalf("have block type %d with %d matches, want a dynamic block without matches", report.BType, report.Matches)
+	}
+	if report.HLIT == nil || *report.HLIT != 0 {
+		t.Fatalf("have hlit %v in %s", report.HLIT, w.String())
+	}
+	if report.HDIST == nil || report.HCLEN == nil {
+		t.Fatalf("missing hdist or hclen in %s", w.String())
+	}
+}
+
+func FuzzDecompress(f *testing.F) {
+
+	f.Add(testhelper_gzip(f, "small.txt"))
+
+	compressed := new(bytes.Buffer)
+	if err := Compress(compressed, strings.NewReader("hello, hello, hello world"), Header{Name: "hello.txt"}); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(compressed.Bytes())
+
+	f.Fuzz(func(t *testing.T, given []byte) {
+		// must not panic, errors are fine
+		Decompress(io.Discard, bytes.NewReader(given))
+		DecompressRaw(io.Discard, bytes.NewReader(given))
+	})
+}
@@ -1,4 +1,4 @@
-package main
+package gzip
 
 import (
 	"fmt"
@@ -10,13 +10,20 @@ type huffmanNode struct {
 	left, right *huffmanNode
 }
 
-func (n *huffmanNode) getElement(s *bitstream) uint64 {
+func (n *huffmanNode) getElement(s *bitstream) (uint64, error) {
 	// fmt.Printf("node: %+v\n", n)
 
+	if n == nil {
+		return 0, newCorruptFileError("invalid Huffman code")
+	}
 	if n.isLeaf {
-		return n.element
+		return n.element, nil
+	}
+	right, err := s.nextBool()
+	if err != nil {
+		return 0, err
 	}
-	if s.nextBool() {
+	if right {
 		return n.right.getElement(s)
 	}
 	return n.left.getElement(s)
@@ -51,7 +58,10 @@ func (n *huffmanNode) insertElement(code uint64, clen int, element uint64) error
 
 }
 
-func generateTree(tree_len []int) (*huffmanNode, error) {
+// canonicalCodes assigns the canonical Huffman code to every symbol of
+// tree_len as described in RFC 1951, section 3.2.2. Symbols with a code
+// length of zero are not assigned a code.
+func canonicalCodes(tree_len []int) []uint64 {
 
 	// 1) Count the number of codes for each code length.
 
@@ -77,13 +87,26 @@ func generateTree(tree_len []int) (*huffmanNode, error) {
 
 	// 3) Assign numerical values to all codes, using consecutive values for all codes of the same length with the base values determined at step 2. Codes that are never used (which have a bit length of zero) must not be assigned a	value.
 
+	codes := make([]uint64, len(tree_len))
+	for n, l := range tree_len {
+		if l != 0 {
+			codes[n] = next_code[l]
+			next_code[l]++
+		}
+	}
+
+	return codes
+}
+
+func generateTree(tree_len []int) (*huffmanNode, error) {
+
 	root := new(huffmanNode)
 
-	for n, l := range tree_len {
+	for n, tree_code := range canonicalCodes(tree_len) {
+
+		l := tree_len[n]
 
 		if l != 0 {
-			tree_code := next_code[l]
-			next_code[l]++
 
 			element := uint64(n)
 			if err := root.insertElement(tree_code, l, element); err != nil {
@@ -102,49 +125,58 @@ func generateTree(tree_len []int) (*huffmanNode, error) {
 	return root, nil
 }
 
-func (d *decompressor) parseHuffmanCodes(litTree, distTree *huffmanNode) error {
+func (d *decompressor) parseHuffmanCodes(litTree, distTree *huffmanTable) error {
 
 	for {
 
-		litCode := litTree.getElement(d.istream)
+		litCode, err := litTree.getElement(d.istream)
+		if err != nil {
+			return err
+		}
 
-		debug(" -> ", litCode, " (", hex(litCode), ")")
+		// the debug output is built per symbol, so it is skipped entirely
+		// unless enabled
+		if DEBUG {
+			debug(" -> ", litCode, " (", hex(litCode), ")")
+		}
 
 		if litCode < 256 {
 			literal := byte(litCode)
-			d.push(literal) // literal
+			if err := d.push(literal); err != nil { // literal
+				return err
+			}
+			d.inspectLiteral()
 		} else if litCode == 256 {
-			debugln(" -> end-of-block")
+			if DEBUG {
+				debugln(" -> end-of-block")
+			}
 			break // end-of-block
 		} else {
 			length, err := d.parseHuffmanLength(litCode)
 			if err != nil {
 				return err
 			}
-			debugln(" -> length:", length)
-
-			// distance, err := d.parseHuffmanDistance(distTree)
-			// if err != nil {
-			// 	return err
-			// }
 
-			distance := 64 - 8 - 7
-
-			if length != 7 {
-				panic("GOT HERE")
+			distance, err := d.parseHuffmanDistance(distTree)
+			if err != nil {
+				return err
 			}
 
-			// 0 .. 6
-			debugln("+++ ", bin(d.istream.nextBits(7+4)))
-
-			debugln(" -> distance:", distance)
-
-			debugf(" -> <l:%d, d:%d>\n", length, distance)
+			if DEBUG {
+				debugln(" -> length:", length)
+				debugln(" -> distance:", distance)
+				debugf(" -> <l:%d, d:%d>\n", length, distance)
+			}
 
-			d.repeat(len(d.history)-distance, length)
+			if err := d.repeat(distance, length); err != nil {
+				return err
+			}
+			d.inspectMatch(length, distance)
 
 		}
-		debugln()
+		if DEBUG {
+			debugln()
+		}
 	}
 
 	return nil
@@ -161,24 +193,36 @@ var baseHuffmanLengths = []uint64{
 	258,
 }
 
+// lengthExtraBits returns the number of extra bits following the length code lencode.
+func lengthExtraBits(lencode uint64) int {
+	if lencode > 264 && lencode < 285 {
+		return int(lencode-265)/4 + 1
+	}
+	return 0
+}
+
 func (d *decompressor) parseHuffmanLength(lencode uint64) (int, error) {
 
 	if lencode < 257 || lencode > 285 {
-		return 0, corruptFileError("unexpected lencode")
+		return 0, newCorruptFileError("unexpected lencode")
 	}
 
-	nExtraBits := 0
-	if lencode > 264 && lencode < 285 {
-		nExtraBits = int(lencode-265)/4 + 1
-	}
+	nExtraBits := lengthExtraBits(lencode)
 
-	debugln(" -> lencode", lencode)
 	baseLength := baseHuffmanLengths[lencode-257]
-	debugln(" -> base length ", baseLength)
 
-	debug(" -> # extra bits = ", nExtraBits, " -> ")
-	extraBits := d.istream.nextBits(nExtraBits)
-	debugln(" -> extra bit value =", extraBits)
+	if DEBUG {
+		debugln(" -> lencode", lencode)
+		debugln(" -> base length ", baseLength)
+		debug(" -> # extra bits = ", nExtraBits, " -> ")
+	}
+	extraBits, err := d.istream.nextBits(nExtraBits)
+	if err != nil {
+		return 0, err
+	}
+	if DEBUG {
+		debugln(" -> extra bit value =", extraBits)
+	}
 
 	return int(baseLength + extraBits), nil
 }
@@ -189,25 +233,39 @@ var baseHuffmanDistances = []uint64{
 	1025, 1537, 2049, 3073, 4097, 6145, 8193, 12289, 16385, 24577,
 }
 
-func (d *decompressor) parseHuffmanDistance(distTree *huffmanNode) (int, error) {
+// distanceExtraBits returns the number of extra bits following the distance code distcode.
+func distanceExtraBits(distcode uint64) int {
+	if distcode > 1 {
+		return int(distcode)/2 - 1
+	}
+	return 0
+}
 
-	distcode := distTree.getElement(d.istream)
+func (d *decompressor) parseHuffmanDistance(distTree *huffmanTable) (int, error) {
 
-	if distcode > 29 {
-		return 0, corruptFileError("unexpected distcode")
+	distcode, err := distTree.getElement(d.istream)
+	if err != nil {
+		return 0, err
 	}
 
-	nExtraBits := 0
-	if distcode > 1 {
-		nExtraBits = int(distcode)/2 - 1
+	if distcode > 29 {
+		return 0, newCorruptFileError("unexpected distcode")
 	}
 
-	debugln(" -> distcode:", distcode)
-	debugln(" -> base dist ", baseHuffmanDistances[distcode])
+	nExtraBits := distanceExtraBits(distcode)
 
-	debug(" -> # extra bits = ", nExtraBits, " -> ")
-	extraBits := d.istream.nextBits(nExtraBits)
-	debugln(" -> extra bit value =", extraBits)
+	if DEBUG {
+		debugln(" -> distcode:", distcode)
+		debugln(" -> base dist ", baseHuffmanDistances[distcode])
+		debug(" -> # extra bits = ", nExtraBits, " -> ")
+	}
+	extraBits, err := d.istream.nextBits(nExtraBits)
+	if err != nil {
+		return 0, err
+	}
+	if DEBUG {
+		debugln(" -> extra bit value =", extraBits)
+	}
 
 	return int(baseHuffmanDistances[distcode] + extraBits), nil
 }
@@ -0,0 +1,142 @@
+package gzip
+
+var clenIdxs = []int{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+
+func (d *decompressor) parseDynamicHuffmanCodes() error {
+
+	debugln(" -> dynamic huffman compression")
+
+	hlit, err := d.istream.nextBits(5)
+	if err != nil {
+		return err
+	}
+	nlit := int(hlit) + 257
+	debugln(" -> hlit:", hlit, "-> nlit:", nlit)
+
+	if nlit > 286 {
+		return newCorruptFileError("too many literal/length codes (%d)", nlit)
+	}
+
+	hdist, err := d.istream.nextBits(5)
+	if err != nil {
+		return err
+	}
+	ndist := int(hdist) + 1
+	debugln(" -> hdist:", hdist, "-> ndist:", ndist)
+
+	if ndist > 30 {
+		return newCorruptFileError("too many distance codes (%d)", ndist)
+	}
+
+	hclen, err := d.istream.nextBits(4)
+	if err != nil {
+		return err
+	}
+	nclen := int(hclen) + 4
+	debugln(" -> hclen:", hclen, "-> nclen:", nclen)
+
+	clens := make([]int, 19)
+	for i := range nclen {
+		clen, err := d.istream.nextBits(3)
+		if err != nil {
+			return err
+		}
+		idx := clenIdxs[i]
+		clens[idx] = int(clen)
+	}
+
+	debugln(" => code length tree:", clens)
+
+	clTree, err := generateTable(clens)
+	if err != nil {
+		return err
+	}
+
+	// the literal/length and distance code lengths form a single sequence,
+	// so a repeat code may cross from one into the other
+	codeLengths, err := d.parseDynamicCodeLengths(clTree, nlit+ndist)
+	if err != nil {
+		return err
+	}
+
+	if codeLengths[256] == 0 {
+		return newCorruptFileError("missing end-of-block code")
+	}
+
+	if d.block != nil {
+		d.block.HLIT = &hlit
+		d.block.HDIST = &hdist
+		d.block.HCLEN = &hclen
+		d.block.CodeLengthLengths = clens
+		d.block.LitLengths = codeLengths[:nlit]
+		d.block.DistLengths = codeLengths[nlit:]
+	}
+
+	debugln(" => literal/value tree")
+
+	litTree, err := generateTable(codeLengths[:nlit])
+	if err != nil {
+		return err
+	}
+
+	debugln(" => distance tree")
+
+	distTree, err := generateTable(codeLengths[nlit:])
+	if err != nil {
+		return err
+	}
+
+	return d.parseHuffmanCodes(litTree, distTree)
+}
+
+func (d *decompressor) parseDynamicCodeLengths(cl *huffmanTable, n int) ([]int, error) {
+
+	codeLengths := make([]int, n)
+	i := 0
+	for i < n {
+		codeLengthCode, err := cl.getElement(d.istream)
+		if err != nil {
+			return nil, err
+		}
+
+		if codeLengthCode < 16 {
+			codeLengths[i] = int(codeLengthCode)
+			i++
+			continue
+		}
+
+		var repeated int
+		var replen uint64
+		switch codeLengthCode {
+		case 16:
+			if i == 0 {
+				return nil, newCorruptFileError("repeat code 16 without previous code length")
+			}
+			repeated = codeLengths[i-1]
+			replen, err = d.istream.nextBits(2)
+			replen += 3
+		case 17:
+			replen, err = d.istream.nextBits(3)
+			replen += 3
+		case 18:
+			replen, err = d.istream.nextBits(7)
+			replen += 11
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if i+int(replen) > n {
+			return nil, newCorruptFileError("code length repeat overflows %d code lengths", n)
+		}
+
+		for range replen {
+			codeLengths[i] = repeated
+			i++
+		}
+	}
+
+	debugf("\n -> code lengths (# = %d): %v\n", len(codeLengths), codeLengths)
+
+	return codeLengths, nil
+}
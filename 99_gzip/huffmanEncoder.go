@@ -0,0 +1,146 @@
+package gzip
+
+import (
+	"slices"
+)
+
+// huffmanEncoding maps every symbol to its canonical code.
+type huffmanEncoding struct {
+	lengths []int
+	codes   []uint64
+}
+
+// newHuffmanEncoding reads the codes off the tree generateTree builds from
+// lengths, the same tree the decompressor decodes with.
+func newHuffmanEncoding(lengths []int) huffmanEncoding {
+
+	root, err := generateTree(lengths)
+	if err != nil {
+		panic(err) // the encoder only produces complete codes
+	}
+
+	e := huffmanEncoding{lengths: make([]int, len(lengths)), codes: make([]uint64, len(lengths))}
+	root.collectCodes(e, 0, 0)
+	return e
+}
+
+// collectCodes stores the code and length of every leaf below n in e.
+func (n *huffmanNode) collectCodes(e huffmanEncoding, code uint64, depth int) {
+	if n == nil {
+		return
+	}
+	if n.isLeaf {
+		e.codes[n.element] = code
+		e.lengths[n.element] = depth
+		return
+	}
+	n.left.collectCodes(e, code<<1, depth+1)
+	n.right.collectCodes(e, code<<1|1, depth+1)
+}
+
+func (e huffmanEncoding) write(s *bitwriter, symbol uint64) {
+	s.writeCode(e.codes[symbol], e.lengths[symbol])
+}
+
+// bits returns the number of bits needed to encode symbols with the given frequencies.
+func (e huffmanEncoding) bits(freqs []int) int {
+	n := 0
+	for symbol, freq := range freqs {
+		n += freq * e.lengths[symbol]
+	}
+	return n
+}
+
+// huffmanCodeLengths derives the code length of every symbol from the symbol
+// frequencies such that no code is longer than maxBits.
+func huffmanCodeLengths(freqs []int, maxBits int) []int {
+	for {
+		lengths := buildCodeLengths(freqs)
+		if slices.Max(lengths) <= maxBits {
+			return lengths
+		}
+
+		// flatten the distribution until the tree is shallow enough
+		flattened := make([]int, len(freqs))
+		for i, freq := range freqs {
+			if freq > 0 {
+				flattened[i] = (freq + 1) / 2
+			}
+		}
+		freqs = flattened
+	}
+}
+
+// buildCodeLengths returns the depth of every symbol in a Huffman tree for
+// freqs. Only the depths are computed, the tree itself is built from them by
+// generateTree.
+func buildCodeLengths(freqs []int) []int {
+
+	type weighted struct {
+		weight int
+		index  int // leaves are symbols, internal nodes are offset by len(freqs)
+	}
+
+	leaves := []weighted{}
+	for symbol, freq := range freqs {
+		if freq > 0 {
+			leaves = append(leaves, weighted{freq, symbol})
+		}
+	}
+
+	// a code needs at least two symbols to be complete
+	for symbol := 0; len(leaves) < 2; symbol++ {
+		if freqs[symbol] == 0 {
+			leaves = append(leaves, weighted{0, symbol})
+		}
+	}
+
+	slices.SortStableFunc(leaves, func(a, b weighted) int {
+		return a.weight - b.weight
+	})
+
+	// two-queue construction: internal nodes are created in order of
+	// increasing weight, so the lightest node is always at the head of one of
+	// the two queues
+	// parents holds the parent of every node, -1 for unused symbols and the root
+	parents := make([]int, len(freqs), len(freqs)+len(leaves))
+	for i := range parents {
+		parents[i] = -1
+	}
+	nodes := []weighted{}
+	pop := func() weighted {
+		if len(nodes) == 0 || (len(leaves) > 0 && leaves[0].weight <= nodes[0].weight) {
+			n := leaves[0]
+			leaves = leaves[1:]
+			return n
+		}
+		n := nodes[0]
+		nodes = nodes[1:]
+		return n
+	}
+
+	for len(leaves)+len(nodes) > 1 {
+		left := pop()
+		right := pop()
+		parent := len(parents)
+		parents = append(parents, -1)
+		parents[left.index] = parent
+		parents[right.index] = parent
+		nodes = append(nodes, weighted{left.weight + right.weight, parent})
+	}
+
+	// every internal node is one deeper than its parent, which was created
+	// after it
+	depths := make([]int, len(parents))
+	for i := len(parents) - 2; i >= len(freqs); i-- {
+		depths[i] = depths[parents[i]] + 1
+	}
+
+	lengths := make([]int, len(freqs))
+	for symbol, parent := range parents[:len(freqs)] {
+		if parent >= 0 {
+			lengths[symbol] = depths[parent] + 1
+		}
+	}
+	return lengths
+}
@@ -1,8 +1,8 @@
-package main
+package gzip
 
 var (
-	fixedHuffmanlitCodes  *huffmanNode
-	fixedHuffmanDistCodes *huffmanNode
+	fixedHuffmanlitCodes  *huffmanTable
+	fixedHuffmanDistCodes *huffmanTable
 )
 
 func (d *decompressor) parseFixedHuffmanCodes() error {
@@ -11,6 +11,16 @@ func (d *decompressor) parseFixedHuffmanCodes() error {
 }
 
 func initFixedHuffmanlitCodes() (err error) {
+	fixedHuffmanlitCodes, err = generateTable(fixedHuffmanlitCodeLengths())
+	return err
+}
+
+func initFixedHuffmanDistCodes() (err error) {
+	fixedHuffmanDistCodes, err = generateTable(fixedHuffmanDistCodeLengths())
+	return err
+}
+
+func fixedHuffmanlitCodeLengths() []int {
 	N := 288
 	fixedHuffmanlitCodeLengths := make([]int, N)
 	for i := 0; i <= 143; i++ {
@@ -26,19 +36,14 @@ func initFixedHuffmanlitCodes() (err error) {
 		fixedHuffmanlitCodeLengths[i] = 8
 	}
 
-	fixedHuffmanlitCodes, err = generateTree(fixedHuffmanlitCodeLengths)
-
-	return err
+	return fixedHuffmanlitCodeLengths
 }
 
-func initFixedHuffmanDistCodes() (err error) {
+func fixedHuffmanDistCodeLengths() []int {
 	N := 32
 	fixedHuffmanDistCodeLengths := make([]int, N)
 	for i := range fixedHuffmanDistCodeLengths {
 		fixedHuffmanDistCodeLengths[i] = 5
 	}
-
-	fixedHuffmanDistCodes, err = generateTree(fixedHuffmanDistCodeLengths)
-
-	return err
+	return fixedHuffmanDistCodeLengths
 }
@@ -0,0 +1,138 @@
+package gzip
+
+import (
+	"fmt"
+)
+
+// huffmanPrimaryBits is the number of bits resolved by the primary lookup
+// table; longer codes continue in an overflow subtable.
+const huffmanPrimaryBits = 9
+
+type huffmanEntry struct {
+	element uint64
+	length  int // code length, 0 if the entry is unused
+
+	// overflow subtable indexed by the bits following the primary bits
+	sub     []huffmanEntry
+	subBits int
+}
+
+// huffmanTable decodes canonical Huffman codes by table lookup instead of
+// walking a huffmanNode tree bit by bit. Tables are indexed by the upcoming
+// bits in stream order, i.e. by the bit-reversed code.
+type huffmanTable struct {
+	primary     []huffmanEntry
+	primaryBits int
+}
+
+func generateTable(tree_len []int) (*huffmanTable, error) {
+
+	maxBits := 0
+	for _, l := range tree_len {
+		maxBits = max(maxBits, l)
+	}
+
+	if err := checkCodeLengths(tree_len, maxBits); err != nil {
+		return nil, err
+	}
+
+	t := &huffmanTable{primaryBits: min(huffmanPrimaryBits, maxBits)}
+	t.primary = make([]huffmanEntry, 1<<t.primaryBits)
+
+	for n, code := range canonicalCodes(tree_len) {
+
+		l := tree_len[n]
+		if l == 0 {
+			continue
+		}
+
+		entry := huffmanEntry{element: uint64(n), length: l}
+		reversed := reverseBits(code, l)
+
+		if l <= t.primaryBits {
+			if err := fillEntries(t.primary, reversed, l, t.primaryBits, entry); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		prefix := &t.primary[reversed&(1<<t.primaryBits-1)]
+		if prefix.length != 0 {
+			return nil, fmt.Errorf("code already in use")
+		}
+		if prefix.sub == nil {
+			prefix.subBits = maxBits - t.primaryBits
+			prefix.sub = make([]huffmanEntry, 1<<prefix.subBits)
+		}
+
+		if err := fillEntries(prefix.sub, reversed>>t.primaryBits, l-t.primaryBits, prefix.subBits, entry); err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// checkCodeLengths rejects over-subscribed codes as well as incomplete codes,
+// except for a code consisting of a single one-bit code (RFC 1951, 3.2.7)
+// and the empty code.
+func checkCodeLengths(tree_len []int, maxBits int) error {
+
+	bl_count := make([]int, maxBits+1)
+	codes := 0
+	for _, l := range tree_len {
+		if l != 0 {
+			bl_count[l]++
+			codes++
+		}
+	}
+
+	// number of unused codes of the current length
+	left := 1
+	for bits := 1; bits <= maxBits; bits++ {
+		left = left<<1 - bl_count[bits]
+		if left < 0 {
+			return newCorruptFileError("over-subscribed Huffman code")
+		}
+	}
+
+	if left > 0 && (codes > 1 || maxBits > 1) {
+		return newCorruptFileError("incomplete Huffman code")
+	}
+
+	return nil
+}
+
+// fillEntries stores entry at every index of table whose lowest l bits
+// equal code.
+func fillEntries(table []huffmanEntry, code uint64, l int, tableBits int, entry huffmanEntry) error {
+	for k := range uint64(1) << (tableBits - l) {
+		idx := code | k<<l
+		if table[idx].length != 0 || table[idx].sub != nil {
+			return fmt.Errorf("code already in use")
+		}
+		table[idx] = entry
+	}
+	return nil
+}
+
+func (t *huffmanTable) getElement(s *bitstream) (uint64, error) {
+
+	entry := t.primary[s.peekBits(t.primaryBits)]
+
+	if entry.sub != nil {
+		if err := s.skipBits(t.primaryBits); err != nil {
+			return 0, err
+		}
+		entry = entry.sub[s.peekBits(entry.subBits)]
+		if entry.length == 0 {
+			return 0, newCorruptFileError("invalid Huffman code")
+		}
+		return entry.element, s.skipBits(entry.length - t.primaryBits)
+	}
+
+	if entry.length == 0 {
+		return 0, newCorruptFileError("invalid Huffman code")
+	}
+	return entry.element, s.skipBits(entry.length)
+}
@@ -0,0 +1,247 @@
+package gzip
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"testing"
+)
+
+func (n *huffmanNode) get(code string) (uint64, error) {
+
+	if n == nil {
+		return 0, fmt.Errorf("code does not exist")
+	}
+
+	if len(code) > 0 {
+		switch code[0] {
+		case '0':
+			return n.left.get(code[1:])
+		case '1':
+			return n.right.get(code[1:])
+		default:
+			return 0, fmt.Errorf("invalid code")
+		}
+
+	}
+
+	if !n.isLeaf {
+		return 0, fmt.Errorf("code does not specify leaf")
+	}
+
+	return n.element, nil
+}
+
+func TestNilNode(t *testing.T) {
+	n := new(huffmanNode)
+	n.insertElement(0b101, 3, 12)
+	val, err := n.get("101")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != 12 {
+		t.Fatal(val)
+	}
+
+}
+
+func Test_generateTree(t *testing.T) {
+	tree_len := []int{3, 3, 3, 3, 3, 2, 4, 4}
+	root, err := generateTree(tree_len)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codes := []string{"010", "011", "100", "101", "110", "00", "1110", "1111"}
+
+	for i, code := range codes {
+		want := uint64(i)
+		if have, err := root.get(code); err != nil {
+			t.Fatal(err)
+		} else if have != want {
+			t.Fatalf("fail for '%s': have %d, got %d", string(byte(have)+'A'), have, want)
+		}
+	}
+}
+
+func Test_decompressor_parseLength(t *testing.T) {
+	type fields struct {
+		istream *bitstream
+		info    map[string][]byte
+		ostream *bufio.Writer
+	}
+	type args struct {
+		val uint64
+	}
+	tests := []struct {
+		name   string
+		fields fields
+		args   args
+		want   int
+	}{
+		{"1", fields{istream: newBitstream(bytes.NewReader([]byte{0b00}))}, args{269}, 19},
+		{"2", fields{istream: newBitstream(bytes.NewReader([]byte{0b01}))}, args{269}, 20},
+		{"3", fields{istream: newBitstream(bytes.NewReader([]byte{0b10}))}, args{269}, 21},
+		{"4", fields{istream: newBitstream(bytes.NewReader([]byte{0b11}))}, args{269}, 22},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &decompressor{
+				istream: tt.fields.istream,
+				info:    tt.fields.info,
+				ostream: tt.fields.ostream,
+			}
+			if got, _ := d.parseHuffmanLength(tt.args.val); got != tt.want {
+				t.Errorf("decompressor.parseLength() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_generateTable(t *testing.T) {
+	tree_len := []int{3, 3, 3, 3, 3, 2, 4, 4}
+	table, err := generateTable(tree_len)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoding := newHuffmanEncoding(tree_len)
+
+	buf := new(bytes.Buffer)
+	w := newBitwriter(buf)
+	for i := range tree_len {
+		encoding.write(w, uint64(i))
+	}
+	w.flush()
+
+	s := newBitstream(buf)
+	for i := range tree_len {
+		want := uint64(i)
+		if have, err := table.getElement(s); err != nil {
+			t.Fatal(err)
+		} else if have != want {
+			t.Fatalf("have %d, want %d", have, want)
+		}
+	}
+}
+
+func Test_generateTableOverflow(t *testing.T) {
+	// codes longer than huffmanPrimaryBits are resolved via a subtable
+	tree_len := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 12}
+	table, err := generateTable(tree_len)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoding := newHuffmanEncoding(tree_len)
+
+	buf := new(bytes.Buffer)
+	w := newBitwriter(buf)
+	for i := len(tree_len) - 1; i >= 0; i-- {
+		encoding.write(w, uint64(i))
+	}
+	w.flush()
+
+	s := newBitstream(buf)
+	for i := len(tree_len) - 1; i >= 0; i-- {
+		want := uint64(i)
+		if have, err := table.getElement(s); err != nil {
+			t.Fatal(err)
+		} else if have != want {
+			t.Fatalf("have %d, want %d", have, want)
+		}
+	}
+}
+
+func Test_huffmanCodeLengths(t *testing.T) {
+	freqs := []int{5, 9, 12, 13, 16, 45, 0, 0}
+	want := []int{4, 4, 3, 3, 3, 1, 0, 0}
+
+	lengths := huffmanCodeLengths(freqs, 15)
+	if !slices.Equal(lengths, want) {
+		t.Fatalf("have %v, want %v", lengths, want)
+	}
+
+	// the encoder must use the codes of the decoding tree
+	tree, err := generateTree(lengths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoding := newHuffmanEncoding(lengths)
+	for symbol, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		code := fmt.Sprintf("%0*b", l, encoding.codes[symbol])
+		if have, err := tree.get(code); err != nil || have != uint64(symbol) {
+			t.Fatalf("code %s: have %d (%v), want %d", code, have, err, symbol)
+		}
+	}
+}
+
+// benchhelper_symbols encodes n pseudo-random literals with the fixed
+// literal/length code.
+func benchhelper_symbols(b *testing.B, n int) []byte {
+	buf := new(bytes.Buffer)
+	w := newBitwriter(buf)
+	for i := range n {
+		fixedHuffmanlitEncoding.write(w, uint64((i*7919)%256))
+	}
+	if err := w.flush(); err != nil {
+		b.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func BenchmarkHuffmanTree(b *testing.B) {
+	const n = 1 << 16
+	data := benchhelper_symbols(b, n)
+	tree, err := generateTree(fixedHuffmanlitCodeLengths())
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(n)
+	for range b.N {
+		s := newBitstream(bytes.NewReader(data))
+		for range n {
+			tree.getElement(s)
+		}
+	}
+}
+
+func BenchmarkHuffmanTable(b *testing.B) {
+	const n = 1 << 16
+	data := benchhelper_symbols(b, n)
+	table, err := generateTable(fixedHuffmanlitCodeLengths())
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(n)
+	for range b.N {
+		s := newBitstream(bytes.NewReader(data))
+		for range n {
+			if _, err := table.getElement(s); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkDecompressLong(b *testing.B) {
+	data, err := os.ReadFile("long.txt.gz")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(data)))
+	for range b.N {
+		if err := Decompress(io.Discard, bytes.NewReader(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
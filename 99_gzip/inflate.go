@@ -0,0 +1,275 @@
+package gzip
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	maxHistoryLength = 0x8000
+)
+
+var DEBUG = false
+
+func init() {
+	if err := initFixedHuffmanlitCodes(); err != nil {
+		panic(err)
+	}
+
+	if err := initFixedHuffmanDistCodes(); err != nil {
+		panic(err)
+	}
+}
+
+// DecompressRaw decodes the raw DEFLATE stream r, i.e. without any header or
+// trailer, and writes the uncompressed data to w.
+func DecompressRaw(w io.Writer, r io.Reader) error {
+	d := newDecompressor(w, r)
+	d.reset(crc32.NewIEEE())
+	return d.finish(d.parseData())
+}
+
+// NewRawReader returns a reader that decompresses the raw DEFLATE stream r
+// on demand.
+func NewRawReader(r io.Reader) io.ReadCloser {
+	return newPipeReader(func(w io.Writer) error {
+		return DecompressRaw(w, r)
+	})
+}
+
+// newPipeReader runs decompress in the background and returns a reader for
+// its output. Closing the reader stops the decompression.
+func newPipeReader(decompress func(io.Writer) error) io.ReadCloser {
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		pw.CloseWithError(decompress(pw))
+	}()
+
+	return pr
+}
+
+// decompressor decodes a sequence of DEFLATE blocks (RFC 1951). The
+// container formats (gzip, zlib or none at all) parse their header and
+// trailer around parseData.
+type decompressor struct {
+	istream *bitstream
+	info    map[string][]byte
+	ostream *bufio.Writer
+
+	// checksum and size of the uncompressed data of the current stream
+	checksum hash.Hash32
+	size     uint32
+
+	// history is a ring buffer of the last maxHistoryLength bytes,
+	// historyPos the number of bytes pushed in the current stream
+	history    [maxHistoryLength]byte
+	historyPos int
+
+	// match is scratch space for the bytes of a back-reference
+	match [maxMatchLength]byte
+
+	// inspect receives a report of every decoded block, if set
+	inspect func(*BlockReport)
+	member  int
+	block   *BlockReport
+}
+
+func newDecompressor(writer io.Writer, reader io.Reader) *decompressor {
+	return &decompressor{
+		istream: newBitstream(reader),
+		ostream: bufio.NewWriter(writer),
+	}
+}
+
+// reset prepares the decompressor for the next stream whose uncompressed
+// data is verified with checksum.
+func (d *decompressor) reset(checksum hash.Hash32) {
+	d.info = make(map[string][]byte)
+	d.checksum = checksum
+	d.size = 0
+	d.historyPos = 0
+}
+
+// presetDictionary makes dict available as history for back-references
+// without emitting it.
+func (d *decompressor) presetDictionary(dict []byte) {
+	d.appendHistory(dict)
+}
+
+// appendHistory adds bs to the history ring buffer.
+func (d *decompressor) appendHistory(bs []byte) {
+
+	// older bytes would be overwritten anyway
+	skipped := max(len(bs)-maxHistoryLength, 0)
+	d.historyPos += skipped
+	bs = bs[skipped:]
+
+	for len(bs) > 0 {
+		n := copy(d.history[d.historyPos%maxHistoryLength:], bs)
+		d.historyPos += n
+		bs = bs[n:]
+	}
+}
+
+// finish flushes the decompressed data and returns err or the flush error.
+func (d *decompressor) finish(err error) error {
+	if flushErr := d.ostream.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+func (d *decompressor) historyLength() int {
+	return min(d.historyPos, maxHistoryLength)
+}
+
+func (d *decompressor) parseData() error {
+	for i := 0; ; i++ {
+		debugln("*** BLOCK", i, "***")
+
+		if d.inspect != nil {
+			d.block = &BlockReport{
+				Member:            d.member,
+				Block:             i,
+				StartBit:          d.istream.ptr,
+				LengthHistogram:   make(map[int]int),
+				DistanceHistogram: make(map[int]int),
+			}
+		}
+
+		eof, err := d.parseBlock()
+		if err != nil {
+			return err
+		}
+
+		if d.block != nil {
+			d.block.EndBit = d.istream.ptr
+			d.inspect(d.block)
+			d.block = nil
+		}
+
+		if eof {
+			debugln("*** END OF BLOCK(S) ***")
+			return nil
+		}
+	}
+}
+
+func (d *decompressor) parseNoCompression() error {
+
+	debugln(" -> no compression")
+
+	d.istream.skipToNextByte()
+
+	raw, err := d.istream.nextBytes(4)
+	if err != nil {
+		return err
+	}
+
+	length := binary.LittleEndian.Uint16(raw[0:2])
+	nLength := binary.LittleEndian.Uint16(raw[2:4])
+
+	if length != ^nLength {
+		return newCorruptFileError("no-compression check failed")
+	}
+
+	debugf("\nLEN: %04X, NLEN: %04X, sum: %04X\n", length, nLength, length-^nLength)
+
+	if d.block != nil {
+		d.block.StoredLength = int(length)
+	}
+
+	data, err := d.istream.nextBytes(int(length))
+	if err != nil {
+		return err
+	}
+
+	return d.push(data...)
+}
+
+func (d *decompressor) push(bs ...byte) error {
+
+	if _, err := d.ostream.Write(bs); err != nil {
+		return err
+	}
+	if DEBUG {
+		// keep the output in order with the debug messages
+		debug("'")
+		d.ostream.Flush()
+		debug("'")
+	}
+
+	d.checksum.Write(bs)
+	d.size += uint32(len(bs))
+
+	d.appendHistory(bs)
+
+	return nil
+}
+
+func (d *decompressor) repeat(distance int, length int) error {
+
+	if distance > d.historyLength() {
+		return newCorruptFileError("distance %d exceeds history of %d bytes", distance, d.historyLength())
+	}
+
+	if length > maxMatchLength {
+		return newCorruptFileError("match length %d exceeds %d", length, maxMatchLength)
+	}
+
+	// copy the first distance bytes from the ring buffer, which may wrap
+	match := d.match[:length]
+	start := (d.historyPos - distance) % maxHistoryLength
+	n := copy(match[:min(distance, length)], d.history[start:])
+	copy(match[n:min(distance, length)], d.history[:])
+
+	// a match longer than its distance repeats the copied bytes
+	for i := distance; i < length; {
+		i += copy(match[i:], match[:i])
+	}
+
+	return d.push(match...)
+}
+
+func (d *decompressor) parseBlock() (bool, error) {
+
+	// read block header
+	bfinal, err := d.istream.nextBool()
+	if err != nil {
+		return false, err
+	}
+
+	btype, err := d.istream.nextBits(2)
+	if err != nil {
+		return false, err
+	}
+
+	if d.block != nil {
+		d.block.BFinal = bfinal
+		d.block.BType = btype
+	}
+
+	switch btype {
+	case 0b00:
+		if err := d.parseNoCompression(); err != nil {
+			return false, err
+		}
+	case 0b01:
+		if err := d.parseFixedHuffmanCodes(); err != nil {
+			return false, err
+		}
+	case 0b10:
+		if err := d.parseDynamicHuffmanCodes(); err != nil {
+			return false, err
+		}
+	case 0b11:
+		return false, newCorruptFileError("unexpected BTYPE 0b11")
+	}
+
+	return bfinal, nil
+}
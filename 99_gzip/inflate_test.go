@@ -0,0 +1,138 @@
+package gzip
+
+import (
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io"
+	"strings"
+	"testing"
+)
+
+// testhelper_rawBlock writes a single final block with the given BTYPE and
+// lets body fill in the rest.
+func testhelper_rawBlock(btype uint64, body func(w *bitwriter)) []byte {
+	buf := new(bytes.Buffer)
+	w := newBitwriter(buf)
+	w.writeBits(1, 1)
+	w.writeBits(btype, 2)
+	body(w)
+	w.flush()
+	return buf.Bytes()
+}
+
+// testhelper_dynamicHeader writes HLIT = HDIST = 0 and the first four code
+// length code lengths (for the symbols 16, 17, 18 and 0).
+func testhelper_dynamicHeader(w *bitwriter, clens [4]uint64) {
+	w.writeBits(0, 5)
+	w.writeBits(0, 5)
+	w.writeBits(0, 4)
+	for _, clen := range clens {
+		w.writeBits(clen, 3)
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	given := testhelper_gzip(t, "small.txt")
+	for n := range len(given) {
+		err := Decompress(io.Discard, bytes.NewReader(given[:n]))
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("%d of %d bytes: have error %v, want %v", n, len(given), err, io.ErrUnexpectedEOF)
+		}
+	}
+}
+
+func TestInvalidDistance(t *testing.T) {
+	given := testhelper_rawBlock(0b01, func(w *bitwriter) {
+		fixedHuffmanlitEncoding.write(w, 'a')
+		fixedHuffmanlitEncoding.write(w, 257) // length 3
+		fixedHuffmanDistEncoding.write(w, 1)  // distance 2
+		fixedHuffmanlitEncoding.write(w, 256)
+	})
+	testhelper_expectCorruptErr(t, DecompressRaw(io.Discard, bytes.NewReader(given)))
+}
+
+func TestRepeat(t *testing.T) {
+	tests := []struct {
+		name     string
+		history  string
+		distance int
+		length   int
+		want     string
+	}{
+		{"copy", "abcdef", 4, 3, "cde"},
+		{"overlap", "ab", 2, 7, "abababa"},
+		{"run", "x", 1, 258, strings.Repeat("x", 258)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			d := newDecompressor(buf, nil)
+			d.reset(crc32.NewIEEE())
+
+			// wrap the history around the end of the ring buffer
+			d.presetDictionary(make([]byte, maxHistoryLength-2))
+			d.presetDictionary([]byte(tt.history))
+
+			if err := d.repeat(tt.distance, tt.length); err != nil {
+				t.Fatal(err)
+			}
+			if err := d.finish(nil); err != nil {
+				t.Fatal(err)
+			}
+			if have := buf.String(); have != tt.want {
+				t.Fatalf("have %q, want %q", have, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepeatWithoutPreviousLength(t *testing.T) {
+	given := testhelper_rawBlock(0b10, func(w *bitwriter) {
+		// code length codes: 0 -> "0", 16 -> "1"
+		testhelper_dynamicHeader(w, [4]uint64{1, 0, 0, 1})
+		w.writeCode(0b1, 1)
+		w.writeBits(0, 2)
+	})
+	testhelper_expectCorruptErr(t, DecompressRaw(io.Discard, bytes.NewReader(given)))
+}
+
+func TestOverSubscribedCode(t *testing.T) {
+	given := testhelper_rawBlock(0b10, func(w *bitwriter) {
+		testhelper_dynamicHeader(w, [4]uint64{1, 1, 1, 1})
+	})
+	testhelper_expectCorruptErr(t, DecompressRaw(io.Discard, bytes.NewReader(given)))
+}
+
+func TestIncompleteCode(t *testing.T) {
+	given := testhelper_rawBlock(0b10, func(w *bitwriter) {
+		testhelper_dynamicHeader(w, [4]uint64{2, 0, 0, 2})
+	})
+	testhelper_expectCorruptErr(t, DecompressRaw(io.Discard, bytes.NewReader(given)))
+}
+
+func TestCodeLengthOverflow(t *testing.T) {
+	given := testhelper_rawBlock(0b10, func(w *bitwriter) {
+		// code length codes: 0 -> "0", 18 -> "1"
+		testhelper_dynamicHeader(w, [4]uint64{0, 0, 1, 1})
+		// 257 + 1 code lengths, but 3 * 138 zeros
+		for range 3 {
+			w.writeCode(0b1, 1)
+			w.writeBits(127, 7)
+		}
+	})
+	testhelper_expectCorruptErr(t, DecompressRaw(io.Discard, bytes.NewReader(given)))
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestWriteError(t *testing.T) {
+	given := testhelper_gzip(t, "long.txt")
+	if err := Decompress(failingWriter{}, bytes.NewReader(given)); err == nil || err.Error() != "disk full" {
+		t.Fatalf("have error %v, want 'disk full'", err)
+	}
+}
@@ -0,0 +1,71 @@
+package gzip
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// BlockReport describes how a single DEFLATE block was encoded.
+type BlockReport struct {
+	Member   int    `json:"member"`
+	Block    int    `json:"block"`
+	BFinal   bool   `json:"bfinal"`
+	BType    uint64 `json:"btype"`
+	StartBit int    `json:"start_bit"`
+	EndBit   int    `json:"end_bit"`
+
+	// stored blocks only
+	StoredLength int `json:"stored_length,omitempty"`
+
+	// dynamic Huffman blocks only, where zero is a valid count
+	HLIT              *uint64 `json:"hlit,omitempty"`
+	HDIST             *uint64 `json:"hdist,omitempty"`
+	HCLEN             *uint64 `json:"hclen,omitempty"`
+	CodeLengthLengths []int   `json:"code_length_lengths,omitempty"`
+	LitLengths        []int   `json:"lit_lengths,omitempty"`
+	DistLengths       []int   `json:"dist_lengths,omitempty"`
+
+	// Huffman blocks only
+	Literals          int         `json:"literals"`
+	Matches           int         `json:"matches"`
+	LengthHistogram   map[int]int `json:"length_histogram,omitempty"`
+	DistanceHistogram map[int]int `json:"distance_histogram,omitempty"`
+}
+
+// Inspect decodes the gzip stream r, discarding the uncompressed data, and
+// writes a JSON report per block to w, one per line.
+func Inspect(w io.Writer, r io.Reader) error {
+
+	enc := json.NewEncoder(w)
+
+	var err error
+
+	d := newDecompressor(io.Discard, r)
+	d.inspect = func(report *BlockReport) {
+		if err == nil {
+			err = enc.Encode(report)
+		}
+	}
+
+	_, parseErr := d.parseMembers()
+
+	if parseErr = d.finish(parseErr); parseErr != nil {
+		return parseErr
+	}
+
+	return err
+}
+
+func (d *decompressor) inspectMatch(length int, distance int) {
+	if d.block != nil {
+		d.block.Matches++
+		d.block.LengthHistogram[length]++
+		d.block.DistanceHistogram[distance]++
+	}
+}
+
+func (d *decompressor) inspectLiteral() {
+	if d.block != nil {
+		d.block.Literals++
+	}
+}
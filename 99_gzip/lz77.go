@@ -0,0 +1,143 @@
+package gzip
+
+const (
+	minMatchLength  = 3
+	maxMatchLength  = 258
+	niceMatchLength = 128
+	maxChainLength  = 64
+	hashBits        = 15
+)
+
+// lz77Token is either a literal byte (length == 0) or a back-reference of
+// length bytes starting distance bytes before the current position.
+type lz77Token struct {
+	literal  byte
+	length   int
+	distance int
+}
+
+// lz77Matcher finds back-references within the last maxHistoryLength bytes.
+// Positions are absolute offsets into the uncompressed stream; window holds
+// the history followed by the data of the current block.
+type lz77Matcher struct {
+	window []byte
+	base   int
+	head   []int
+	prev   []int
+}
+
+func newLz77Matcher() *lz77Matcher {
+	return &lz77Matcher{
+		window: []byte{},
+		head:   make([]int, 1<<hashBits),
+		prev:   make([]int, maxHistoryLength),
+	}
+}
+
+// preset makes the last maxHistoryLength bytes of dict available for
+// back-references.
+func (m *lz77Matcher) preset(dict []byte) {
+	dict = dict[max(0, len(dict)-maxHistoryLength):]
+	m.window = append(m.window, dict...)
+	end := m.base + len(m.window)
+	for pos := m.base; pos < end; pos++ {
+		m.insert(pos, end)
+	}
+}
+
+func (m *lz77Matcher) tokenize(data []byte) []lz77Token {
+
+	pos := m.base + len(m.window)
+	m.window = append(m.window, data...)
+	end := m.base + len(m.window)
+
+	tokens := make([]lz77Token, 0, len(data))
+
+	length, distance := m.findMatch(pos, end)
+	for pos < end {
+
+		m.insert(pos, end)
+
+		if length < minMatchLength {
+			tokens = append(tokens, lz77Token{literal: m.at(pos)})
+			pos++
+			length, distance = m.findMatch(pos, end)
+			continue
+		}
+
+		// lazy evaluation: prefer a longer match starting at the next byte
+		if nextLength, nextDistance := m.findMatch(pos+1, end); nextLength > length {
+			tokens = append(tokens, lz77Token{literal: m.at(pos)})
+			pos++
+			length, distance = nextLength, nextDistance
+			continue
+		}
+
+		tokens = append(tokens, lz77Token{length: length, distance: distance})
+		for i := 1; i < length; i++ {
+			m.insert(pos+i, end)
+		}
+		pos += length
+		length, distance = m.findMatch(pos, end)
+	}
+
+	m.slide()
+
+	return tokens
+}
+
+func (m *lz77Matcher) at(pos int) byte {
+	return m.window[pos-m.base]
+}
+
+func (m *lz77Matcher) hash(pos int) int {
+	i := pos - m.base
+	return (int(m.window[i])<<10 ^ int(m.window[i+1])<<5 ^ int(m.window[i+2])) & (1<<hashBits - 1)
+}
+
+func (m *lz77Matcher) insert(pos int, end int) {
+	if end-pos < minMatchLength {
+		return
+	}
+	h := m.hash(pos)
+	m.prev[pos%maxHistoryLength] = m.head[h]
+	m.head[h] = pos + 1
+}
+
+func (m *lz77Matcher) findMatch(pos int, end int) (int, int) {
+
+	if end-pos < minMatchLength {
+		return 0, 0
+	}
+
+	maxLength := min(maxMatchLength, end-pos)
+	bestLength, bestDistance := 0, 0
+
+	cand := m.head[m.hash(pos)] - 1
+	for chain := 0; chain < maxChainLength && cand >= 0 && pos-cand <= maxHistoryLength; chain++ {
+
+		length := 0
+		for length < maxLength && m.at(cand+length) == m.at(pos+length) {
+			length++
+		}
+
+		if length > bestLength {
+			bestLength, bestDistance = length, pos-cand
+			if length >= niceMatchLength {
+				break
+			}
+		}
+
+		cand = m.prev[cand%maxHistoryLength] - 1
+	}
+
+	return bestLength, bestDistance
+}
+
+// slide drops everything but the last maxHistoryLength bytes from the window.
+func (m *lz77Matcher) slide() {
+	if drop := len(m.window) - maxHistoryLength; drop > 0 {
+		m.window = append(make([]byte, 0, 2*maxHistoryLength), m.window[drop:]...)
+		m.base += drop
+	}
+}
@@ -0,0 +1,73 @@
+package gzip
+
+import (
+	"fmt"
+	"io"
+)
+
+func debug(a ...any) {
+	if DEBUG {
+		fmt.Print(a...)
+	}
+}
+
+func debugf(format string, a ...any) {
+	if DEBUG {
+		fmt.Printf(format, a...)
+	}
+}
+
+func debugln(a ...any) {
+	if DEBUG {
+		fmt.Println(a...)
+	}
+}
+
+func hex(v uint64) string {
+	return fmt.Sprintf("0x%X", v)
+}
+
+func bin(v uint64) string {
+	return fmt.Sprintf("0b%b", v)
+}
+
+func bits(b byte) []bool {
+	bs := make([]bool, 8)
+	for i := range bs {
+		// bs[i] = (b & (1 << (8 - i))) > 0
+		bs[i] = (b & (1 << i)) > 0
+	}
+	return bs
+}
+
+// reverseBits reverses the order of the n lowest bits of code.
+func reverseBits(code uint64, n int) uint64 {
+	reversed := uint64(0)
+	for i := 0; i < n; i++ {
+		reversed = (reversed << 1) | ((code >> i) & 1)
+	}
+	return reversed
+}
+
+// corruptFileError reports a gzip file that is malformed or fails one of its
+// integrity checks.
+type corruptFileError struct {
+	msg string
+	err error
+}
+
+func (e *corruptFileError) Error() string {
+	return "corrupt GZIP file: " + e.msg
+}
+
+func (e *corruptFileError) Unwrap() error {
+	return e.err
+}
+
+func newCorruptFileError(format string, a ...any) error {
+	return &corruptFileError{msg: fmt.Sprintf(format, a...)}
+}
+
+func newTruncatedFileError() error {
+	return &corruptFileError{msg: "unexpected end of file", err: io.ErrUnexpectedEOF}
+}
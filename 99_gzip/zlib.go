@@ -0,0 +1,110 @@
+package gzip
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/adler32"
+	"io"
+)
+
+// DecompressZlib decodes the zlib stream r (RFC 1950) and writes the
+// uncompressed data to w. dict is the preset dictionary, if the stream
+// requires one.
+func DecompressZlib(w io.Writer, r io.Reader, dict []byte) error {
+	d := newDecompressor(w, r)
+	return d.finish(d.parseZlib(dict))
+}
+
+// NewZlibReader returns a reader that decompresses the zlib stream r on
+// demand.
+func NewZlibReader(r io.Reader, dict []byte) io.ReadCloser {
+	return newPipeReader(func(w io.Writer) error {
+		return DecompressZlib(w, r, dict)
+	})
+}
+
+func (d *decompressor) parseZlib(dict []byte) error {
+
+	d.reset(adler32.New())
+
+	if err := d.parseZlibHeader(dict); err != nil {
+		return err
+	}
+
+	for key, val := range d.info {
+		debugf("[INFO] %s: '%s' %v\n", key, string(val), val)
+	}
+
+	if err := d.parseData(); err != nil {
+		return err
+	}
+
+	return d.parseZlibTrailer()
+}
+
+func (d *decompressor) parseZlibHeader(dict []byte) error {
+
+	header, err := d.istream.nextBytes(2)
+	if err != nil {
+		return err
+	}
+
+	cmf, flg := header[0], header[1]
+
+	if (uint16(cmf)<<8|uint16(flg))%31 != 0 {
+		return newCorruptFileError("zlib header check failed for [0x%02X 0x%02X]", cmf, flg)
+	}
+
+	if method := cmf & 0x0F; method != 0x08 {
+		return newCorruptFileError("unexpected compression method %x", method)
+	}
+
+	if cinfo := cmf >> 4; cinfo > 7 {
+		return newCorruptFileError("window size 2^%d exceeds 32K", cinfo+8)
+	}
+
+	d.info["flevel"] = []byte(fmt.Sprint(flg >> 6))
+
+	if (flg & 0x20) == 0 {
+		return nil
+	}
+
+	raw, err := d.istream.nextBytes(4)
+	if err != nil {
+		return err
+	}
+
+	dictid := binary.BigEndian.Uint32(raw)
+	d.info["dictid"] = []byte(fmt.Sprintf("0x%08X", dictid))
+
+	if dict == nil {
+		return newCorruptFileError("preset dictionary 0x%08X required", dictid)
+	}
+
+	if have := adler32.Checksum(dict); have != dictid {
+		return newCorruptFileError("preset dictionary 0x%08X does not match 0x%08X", have, dictid)
+	}
+
+	d.presetDictionary(dict)
+
+	return nil
+}
+
+func (d *decompressor) parseZlibTrailer() error {
+
+	d.istream.skipToNextByte()
+
+	trailer, err := d.istream.nextBytes(4)
+	if err != nil {
+		return err
+	}
+
+	want := binary.BigEndian.Uint32(trailer)
+	have := d.checksum.Sum32()
+	debugf("[INFO] adler32: 0x%08X (computed: 0x%08X)\n", want, have)
+	if have != want {
+		return newCorruptFileError("Adler-32 0x%08X does not match 0x%08X", have, want)
+	}
+
+	return nil
+}
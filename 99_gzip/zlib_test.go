@@ -0,0 +1,101 @@
+package gzip
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"io"
+	"os"
+	"testing"
+)
+
+func testhelper_readFile(t *testing.T, path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestZlib(t *testing.T) {
+
+	want := testhelper_readFile(t, "long.txt")
+
+	compressed := new(bytes.Buffer)
+	zw := zlib.NewWriter(compressed)
+	zw.Write(want)
+	zw.Close()
+
+	w := new(bytes.Buffer)
+	if err := DecompressZlib(w, compressed, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if have := w.Bytes(); !bytes.Equal(have, want) {
+		t.Fatalf("have %d bytes, want %d bytes", len(have), len(want))
+	}
+}
+
+func TestZlibDictionary(t *testing.T) {
+
+	dict := testhelper_readFile(t, "small.txt")
+	want := append(bytes.Repeat([]byte("ABCA"), 10), dict[:100]...)
+
+	compressed := new(bytes.Buffer)
+	zw, err := zlib.NewWriterLevelDict(compressed, zlib.BestCompression, dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw.Write(want)
+	zw.Close()
+
+	w := new(bytes.Buffer)
+	if err := DecompressZlib(w, bytes.NewReader(compressed.Bytes()), dict); err != nil {
+		t.Fatal(err)
+	}
+
+	if have := w.Bytes(); !bytes.Equal(have, want) {
+		t.Fatalf("have '%s', want '%s'", have, want)
+	}
+
+	testhelper_expectCorruptErr(t, DecompressZlib(io.Discard, bytes.NewReader(compressed.Bytes()), nil))
+	testhelper_expectCorruptErr(t, DecompressZlib(io.Discard, bytes.NewReader(compressed.Bytes()), want))
+}
+
+func TestZlibCorruptAdler32(t *testing.T) {
+
+	compressed := new(bytes.Buffer)
+	zw := zlib.NewWriter(compressed)
+	zw.Write(testhelper_readFile(t, "small.txt"))
+	zw.Close()
+
+	given := compressed.Bytes()
+	given[len(given)-1] ^= 0x01
+
+	testhelper_expectCorruptErr(t, DecompressZlib(io.Discard, bytes.NewReader(given), nil))
+}
+
+func TestRawDeflate(t *testing.T) {
+
+	want := testhelper_readFile(t, "random.txt")
+
+	compressed := new(bytes.Buffer)
+	fw, err := flate.NewWriter(compressed, flate.DefaultCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(want)
+	fw.Close()
+
+	r := NewRawReader(compressed)
+	defer r.Close()
+
+	have, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(have, want) {
+		t.Fatalf("have %d bytes, want %d bytes", len(have), len(want))
+	}
+}